@@ -0,0 +1,110 @@
+// voltalis-audit consulte le journal d'audit des écritures envoyées à Voltalis par l'add-on.
+//
+// Exemples :
+//
+//	voltalis-audit -heater 12345 -since 24h
+//	voltalis-audit -since "2025-01-10 08:00" -until "2025-01-10 12:00" -json
+//	voltalis-audit -tz Europe/Paris -since "2025-01-10 08:00"
+//
+// Les dates saisies et affichées sont dans le fuseau -tz, à défaut celui du conteneur (variable TZ, UTC sinon)
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	// Base des fuseaux horaires embarquée : l'image de l'add-on n'en fournit pas forcément
+	_ "time/tzdata"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/audit"
+)
+
+func main() {
+	file := flag.String("file", filepath.Join("/config/voltalis", audit.FileName), "chemin du journal d'audit")
+	heater := flag.Int("heater", 0, "ID d'appliance du radiateur (tous si absent)")
+	since := flag.String("since", "", "début de la période : date (2006-01-02 15:04) ou durée écoulée (24h)")
+	until := flag.String("until", "", "fin de la période : date (2006-01-02 15:04) ou durée écoulée (1h)")
+	asJSON := flag.Bool("json", false, "afficher les entrées brutes (une ligne JSON par entrée)")
+	tz := flag.String("tz", "", "fuseau horaire IANA des dates saisies et affichées, Europe/Paris par exemple (fuseau du conteneur si absent)")
+	flag.Parse()
+
+	location := time.Local
+	if *tz != "" {
+		var err error
+		if location, err = time.LoadLocation(*tz); err != nil {
+			fail(fmt.Errorf("fuseau horaire invalide: %w", err))
+		}
+	}
+
+	filter := audit.Filter{ApplianceID: *heater}
+	var err error
+	if filter.Since, err = parseTime(*since, location); err != nil {
+		fail(err)
+	}
+	if filter.Until, err = parseTime(*until, location); err != nil {
+		fail(err)
+	}
+
+	entries, err := audit.Read(*file, filter)
+	if err != nil {
+		fail(err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	for _, entry := range entries {
+		if *asJSON {
+			if err := encoder.Encode(entry); err != nil {
+				fail(err)
+			}
+			continue
+		}
+		fmt.Println(format(entry, location))
+	}
+}
+
+// parseTime interprète une borne de période : date absolue dans le fuseau location, ou durée écoulée depuis maintenant
+func parseTime(value string, location *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("date invalide: %q", value)
+}
+
+// format présente une entrée sur une ligne lisible, l'heure étant affichée dans le fuseau location
+func format(entry audit.Entry, location *time.Location) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %-4s %s  statut=%d  %dms", entry.Time.In(location).Format("2006-01-02 15:04:05 MST"), entry.Method, entry.Path, entry.Status, entry.LatencyMs)
+	if len(entry.ApplianceIDs) > 0 {
+		fmt.Fprintf(&b, "  radiateurs=%v", entry.ApplianceIDs)
+	}
+	if entry.Cause != nil {
+		fmt.Fprintf(&b, "  source=%s", entry.Cause.Source)
+		for _, command := range entry.Cause.Commands {
+			fmt.Fprintf(&b, "  %s=%q", command.Topic, command.Payload)
+		}
+	}
+	if entry.Error != "" {
+		fmt.Fprintf(&b, "  erreur=%q", entry.Error)
+	}
+	fmt.Fprintf(&b, "\n    requête: %s", entry.Request)
+	if entry.Cause != nil && len(entry.Cause.Changes) > 0 {
+		fmt.Fprintf(&b, "\n    changements: %s", entry.Cause.Changes)
+	}
+	return b.String()
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "erreur:", err)
+	os.Exit(1)
+}
@@ -5,12 +5,17 @@ import (
 	"fmt"
 	"log/slog"
 	"time"
+	// Base des fuseaux horaires embarquée : l'image de l'add-on n'en fournit pas forcément
+	_ "time/tzdata"
 
 	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/audit"
 	"github.com/francois76/voltalis-integration/voltalis/internal/config"
+	"github.com/francois76/voltalis-integration/voltalis/internal/homeassistant"
 	"github.com/francois76/voltalis-integration/voltalis/internal/logger"
 	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
 	"github.com/francois76/voltalis-integration/voltalis/internal/scheduler"
+	"github.com/francois76/voltalis-integration/voltalis/internal/store"
 	"github.com/francois76/voltalis-integration/voltalis/internal/transform"
 	"golang.org/x/sync/errgroup"
 )
@@ -22,10 +27,16 @@ func main() {
 		panic(err)
 	}
 	slog.With("options", opts).Info("loading options")
+	if err := mqtt.ConfigureDurations(opts.DurationOptions); err != nil {
+		panic(err)
+	}
 	mqttClient, err := mqtt.InitClient("tcp://"+opts.MqttURL, "voltalis-addon", opts.MqttUser, opts.MqttPassword)
 	if err != nil {
 		panic(err)
 	}
+	mqttClient.DeviceDiscovery = opts.DeviceDiscovery
+	mqttClient.JSONState = opts.JSONState
+	mqttClient.ReadOnly = opts.ReadOnly
 	slog.Info("MQTT client initialized")
 
 	apiClient, err := api.NewClient("https://api.myvoltalis.com", opts.VoltalisLogin, opts.VoltalisPassword)
@@ -33,11 +44,28 @@ func main() {
 		panic(err)
 	}
 
+	haClient := homeassistant.NewClient()
+	location := resolveLocation(opts, haClient, apiClient)
+	apiClient.Location = location
+	mqttClient.Location = location
+	// Sans persistance, l'add-on fonctionne mais oublie son état à chaque redémarrage
+	st, err := store.New(opts.StateDir)
+	if err != nil {
+		slog.Error("persistance désactivée", "error", err)
+		st = nil
+	}
+	mqttClient.EnablePersistence(st)
+	// Journal d'audit des écritures Voltalis, à côté de l'état persisté
+	var auditLog *audit.Log
+	if st != nil {
+		auditLog = audit.New(opts.StateDir, int64(opts.AuditMaxSize)<<20)
+		apiClient.OnWrite = auditLog.RecordWrite
+	}
+	bridge := transform.NewBridge(mqttClient, apiClient, haClient, st, auditLog, opts)
+
 	g, ctx := errgroup.WithContext(context.Background())
 
-	s := scheduler.New(15*time.Second, func() error {
-		return transform.SyncVoltalisHeatersToHA(mqttClient, apiClient)
-	})
+	s := scheduler.New(15*time.Second, bridge.SyncVoltalisHeatersToHA)
 	s.Trigger()
 	g.Go(func() error {
 
@@ -46,7 +74,7 @@ func main() {
 	})
 
 	g.Go(func() error {
-		return transform.Start(ctx, mqttClient, apiClient, s)
+		return bridge.Start(ctx, s)
 	})
 
 	// Attendre que toutes les goroutines se terminent
@@ -56,3 +84,29 @@ func main() {
 	}
 
 }
+
+// resolveLocation détermine le fuseau horaire du site : option de l'add-on, puis configuration de Home Assistant,
+// puis pays du site Voltalis, et à défaut celui du conteneur
+func resolveLocation(opts *config.Options, haClient *homeassistant.Client, apiClient *api.Client) *time.Location {
+	if opts.Timezone != "" {
+		location, err := time.LoadLocation(opts.Timezone)
+		if err == nil {
+			return location
+		}
+		slog.Error("fuseau horaire invalide, option ignorée", "timezone", opts.Timezone, "error", err)
+	}
+	if haClient.Available() {
+		if cfg, err := haClient.GetConfig(); err != nil {
+			slog.Warn("impossible de lire le fuseau horaire de Home Assistant", "error", err)
+		} else if location, err := time.LoadLocation(cfg.TimeZone); err == nil && cfg.TimeZone != "" {
+			slog.Info("fuseau horaire de Home Assistant", "timezone", location)
+			return location
+		}
+	}
+	if location, ok := api.SiteLocation(apiClient.Site); ok {
+		slog.Info("fuseau horaire déduit du pays du site", "country", apiClient.Site.Country, "timezone", location)
+		return location
+	}
+	slog.Warn("fuseau horaire du site inconnu, utilisation de celui du conteneur", "timezone", time.Local)
+	return time.Local
+}
@@ -14,6 +14,11 @@ type Client struct {
 	HTTPClient *http.Client
 	Token      string
 	SiteID     int
+	Site       Site
+	// Location est le fuseau horaire du site, dans lequel Voltalis exprime ses dates (heure du conteneur si nil)
+	Location *time.Location
+	// OnWrite est appelé après chaque écriture (PUT/POST) envoyée à Voltalis, typiquement pour l'audit
+	OnWrite func(WriteRecord)
 }
 
 func NewClient(baseURL, login, password string) (*Client, error) {
@@ -30,6 +35,7 @@ func NewClient(baseURL, login, password string) (*Client, error) {
 		return nil, err
 	}
 	c.SiteID = me.DefaultSite.ID
+	c.Site = me.DefaultSite
 	return c, nil
 }
 
@@ -71,26 +77,38 @@ func (c *Client) get(path string, out interface{}) error {
 }
 
 func (c *Client) put(path string, body interface{}, out interface{}) error {
-	b, _ := json.Marshal(body)
-	slog.Debug("API PUT request", "path", path, "body", string(b))
-	req, _ := http.NewRequest("PUT", c.BaseURL+path, bytes.NewBuffer(b))
-	req.Header.Set("Authorization", "Bearer "+c.Token)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if out != nil {
-		return json.NewDecoder(resp.Body).Decode(out)
-	}
-	return nil
+	return c.write("PUT", path, body, out)
 }
 
 func (c *Client) post(path string, body interface{}, out interface{}) error {
+	return c.write("POST", path, body, out)
+}
+
+// WriteRecord décrit une écriture envoyée à Voltalis, transmise à OnWrite une fois la réponse reçue
+type WriteRecord struct {
+	Method  string
+	Path    string
+	Body    []byte
+	Status  int // 0 si la requête n'a pas abouti
+	Latency time.Duration
+	Err     error
+}
+
+// write envoie une requête d'écriture (PUT ou POST) et la signale à OnWrite
+func (c *Client) write(method, path string, body interface{}, out interface{}) (err error) {
 	b, _ := json.Marshal(body)
-	slog.Debug("API POST request", "path", path, "body", string(b))
-	req, _ := http.NewRequest("POST", c.BaseURL+path, bytes.NewBuffer(b))
+	slog.Debug("API "+method+" request", "path", path, "body", string(b))
+	record := WriteRecord{Method: method, Path: path, Body: b}
+	start := time.Now()
+	defer func() {
+		if c.OnWrite != nil {
+			record.Latency = time.Since(start)
+			record.Err = err
+			c.OnWrite(record)
+		}
+	}()
+
+	req, _ := http.NewRequest(method, c.BaseURL+path, bytes.NewBuffer(b))
 	req.Header.Set("Authorization", "Bearer "+c.Token)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := c.HTTPClient.Do(req)
@@ -98,6 +116,7 @@ func (c *Client) post(path string, body interface{}, out interface{}) error {
 		return err
 	}
 	defer resp.Body.Close()
+	record.Status = resp.StatusCode
 	if out != nil {
 		return json.NewDecoder(resp.Body).Decode(out)
 	}
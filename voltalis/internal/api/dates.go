@@ -0,0 +1,52 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+// DateLayout est le format des dates Voltalis : heure locale du site, sans fuseau
+const DateLayout = "2006-01-02T15:04:05"
+
+// countryLocations associe le pays d'un site Voltalis à son fuseau horaire
+var countryLocations = map[string]string{
+	"FR":       "Europe/Paris",
+	"FRANCE":   "Europe/Paris",
+	"BE":       "Europe/Brussels",
+	"BELGIQUE": "Europe/Brussels",
+	"BELGIUM":  "Europe/Brussels",
+	"LU":       "Europe/Luxembourg",
+	"CH":       "Europe/Zurich",
+	"SUISSE":   "Europe/Zurich",
+}
+
+// SiteLocation retourne le fuseau horaire déduit du pays du site (false si le pays est inconnu)
+func SiteLocation(site Site) (*time.Location, bool) {
+	name, ok := countryLocations[strings.ToUpper(strings.TrimSpace(site.Country))]
+	if !ok {
+		return nil, false
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, false
+	}
+	return location, true
+}
+
+// location retourne le fuseau du site, ou celui du conteneur s'il n'a pas été configuré
+func (c *Client) location() *time.Location {
+	if c.Location == nil {
+		return time.Local
+	}
+	return c.Location
+}
+
+// FormatDate formate une date dans l'heure locale du site, comme attendu par l'API Voltalis
+func (c *Client) FormatDate(t time.Time) string {
+	return t.In(c.location()).Format(DateLayout)
+}
+
+// ParseDate interprète une date Voltalis dans le fuseau du site
+func (c *Client) ParseDate(value string) (time.Time, error) {
+	return time.ParseInLocation(DateLayout, value, c.location())
+}
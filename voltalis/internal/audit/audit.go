@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+)
+
+const (
+	// FileName est le nom du journal d'audit dans le répertoire de persistance de l'add-on
+	FileName = "audit.jsonl"
+	// DefaultMaxSize est la taille au-delà de laquelle le journal est archivé (5 Mo)
+	DefaultMaxSize = 5 << 20
+	// maxBackups est le nombre d'archives conservées (audit.jsonl.1 étant la plus récente)
+	maxBackups = 3
+)
+
+// Command est une commande MQTT reçue de Home Assistant
+type Command struct {
+	Topic   string    `json:"topic"`
+	Payload string    `json:"payload"`
+	At      time.Time `json:"at"`
+}
+
+// Cause décrit ce qui a déclenché les écritures en cours : commandes HA et changement d'état,
+// ou traitement interne de l'add-on (régulation, fenêtre, expiration de boost...)
+type Cause struct {
+	Source   string          `json:"source"`
+	Commands []Command       `json:"commands,omitempty"`
+	Changes  json.RawMessage `json:"changes,omitempty"`
+}
+
+// Entry est une ligne du journal d'audit : une écriture envoyée à Voltalis
+type Entry struct {
+	Time         time.Time       `json:"time"`
+	ApplianceIDs []int           `json:"appliance_ids,omitempty"`
+	Cause        *Cause          `json:"cause,omitempty"`
+	Method       string          `json:"method"`
+	Path         string          `json:"path"`
+	Request      json.RawMessage `json:"request,omitempty"`
+	Status       int             `json:"status"`
+	LatencyMs    int64           `json:"latency_ms"`
+	Error        string          `json:"error,omitempty"`
+}
+
+// Log est un journal d'audit en ajout seul (une entrée JSON par ligne), archivé par taille
+type Log struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	cause   *Cause
+}
+
+// New ouvre le journal d'audit du répertoire dir. maxSize <= 0 utilise DefaultMaxSize
+func New(dir string, maxSize int64) *Log {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	return &Log{path: filepath.Join(dir, FileName), maxSize: maxSize}
+}
+
+// SetCause associe les écritures suivantes à leur déclencheur, jusqu'à l'appel de la fonction retournée
+func (l *Log) SetCause(cause Cause) (clear func()) {
+	l.mu.Lock()
+	l.cause = &cause
+	l.mu.Unlock()
+	return func() {
+		l.mu.Lock()
+		l.cause = nil
+		l.mu.Unlock()
+	}
+}
+
+// RecordWrite ajoute une écriture Voltalis au journal (branché sur api.Client.OnWrite)
+func (l *Log) RecordWrite(record api.WriteRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := Entry{
+		Time:         time.Now(),
+		ApplianceIDs: applianceIDs(record.Body),
+		Cause:        l.cause,
+		Method:       record.Method,
+		Path:         record.Path,
+		Request:      json.RawMessage(record.Body),
+		Status:       record.Status,
+		LatencyMs:    record.Latency.Milliseconds(),
+	}
+	if entry.Cause == nil {
+		entry.Cause = &Cause{Source: "addon"}
+	}
+	if record.Err != nil {
+		entry.Error = record.Err.Error()
+	}
+	if err := l.append(entry); err != nil {
+		slog.Error("failed to write audit entry", "path", l.path, "error", err)
+	}
+}
+
+// append écrit une entrée en fin de journal, après archivage si la taille maximale est atteinte
+func (l *Log) append(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	if info, err := os.Stat(l.path); err == nil && info.Size()+int64(len(data)) >= l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("impossible d'ouvrir %s: %w", l.path, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("impossible d'écrire dans %s: %w", l.path, err)
+	}
+	return nil
+}
+
+// rotate décale les archives (audit.jsonl.1 -> audit.jsonl.2...) et archive le journal courant
+func (l *Log) rotate() error {
+	os.Remove(backupPath(l.path, maxBackups))
+	for i := maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backupPath(l.path, i), backupPath(l.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	}
+	if err := os.Rename(l.path, backupPath(l.path, 1)); err != nil {
+		return fmt.Errorf("failed to rotate audit log: %w", err)
+	}
+	return nil
+}
+
+func backupPath(path string, index int) string {
+	return fmt.Sprintf("%s.%d", path, index)
+}
+
+// applianceIDs extrait les radiateurs concernés par une requête (réglage manuel ou quicksetting)
+func applianceIDs(body []byte) []int {
+	var request struct {
+		IDAppliance        int `json:"idAppliance"`
+		AppliancesSettings []struct {
+			IDAppliance int `json:"idAppliance"`
+		} `json:"appliancesSettings"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil
+	}
+	var ids []int
+	if request.IDAppliance != 0 {
+		ids = append(ids, request.IDAppliance)
+	}
+	for _, setting := range request.AppliancesSettings {
+		ids = append(ids, setting.IDAppliance)
+	}
+	return ids
+}
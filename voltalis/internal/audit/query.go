@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// Filter sélectionne les entrées du journal. Les champs vides ne filtrent pas
+type Filter struct {
+	ApplianceID int
+	Since       time.Time
+	Until       time.Time
+}
+
+// Match indique si une entrée correspond au filtre
+func (f Filter) Match(entry Entry) bool {
+	if f.ApplianceID != 0 && !slices.Contains(entry.ApplianceIDs, f.ApplianceID) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Time.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Read lit le journal d'audit path et ses archives, de la plus ancienne à la plus récente,
+// et retourne les entrées correspondant au filtre
+func Read(path string, filter Filter) ([]Entry, error) {
+	var entries []Entry
+	files := []string{path}
+	for i := 1; i <= maxBackups; i++ {
+		files = append([]string{backupPath(path, i)}, files...)
+	}
+	for _, file := range files {
+		fileEntries, err := readFile(file, filter)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, fileEntries...)
+	}
+	return entries, nil
+}
+
+func readFile(path string, filter Filter) ([]Entry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("impossible d'ouvrir %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	// Les requêtes de quicksettings peuvent dépasser la taille de ligne par défaut
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("entrée invalide %s:%d: %w", path, line, err)
+		}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("impossible de lire %s: %w", path, err)
+	}
+	return entries, nil
+}
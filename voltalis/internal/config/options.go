@@ -13,6 +13,105 @@ type Options struct {
 	MqttPassword     string `json:"mqtt_password"`
 	VoltalisLogin    string `json:"voltalis_login"`
 	VoltalisPassword string `json:"voltalis_password"`
+	DeviceDiscovery  bool   `json:"device_discovery"`
+	JSONState        bool   `json:"json_state"`
+	// Répertoire de persistance de l'état de l'add-on (/config/voltalis par défaut)
+	StateDir string `json:"state_dir"`
+	// Durée en minutes du boost quand aucune durée limitée n'est sélectionnée (30 par défaut)
+	BoostDuration int `json:"boost_duration"`
+	// Options du select de durée (ex: "30m", "2h", "1d"), 1 à 4 heures par défaut
+	DurationOptions []string `json:"duration_options"`
+	// Fenêtre en millisecondes pendant laquelle les commandes HA d'un même radiateur sont regroupées (1000 par défaut)
+	DebounceMs int `json:"debounce_ms"`
+	// Fuseau horaire du site (ex: "Europe/Paris"). Par défaut celui de Home Assistant, ou déduit du pays du site Voltalis
+	Timezone string `json:"timezone"`
+	// Expose les entités sans jamais écrire chez Voltalis : les commandes HA sont rejetées
+	ReadOnly bool `json:"read_only"`
+	// Calcule et publie sur voltalis/debug/dry_run les requêtes qui auraient été envoyées à Voltalis, sans les envoyer
+	DryRun bool `json:"dry_run"`
+	// Taille en Mo au-delà de laquelle le journal d'audit des écritures Voltalis est archivé (5 par défaut)
+	AuditMaxSize int `json:"audit_max_size"`
+	// Arbitrage quand un radiateur est modifié hors de HA après une commande HA : "voltalis" (par défaut) adopte
+	// l'état Voltalis, "home_assistant" réapplique la demande HA, "last_writer" retient la modification la plus récente
+	ConflictPolicy string `json:"conflict_policy"`
+
+	Heaters []HeaterOptions `json:"heaters"`
+	// Règles de sécurité appliquées à chaque écriture envoyée à Voltalis
+	Policies []PolicyOptions `json:"policies"`
+}
+
+// PolicyOptions décrit une règle de sécurité : une commande qui l'enfreint est ajustée ou bloquée avant d'être envoyée à Voltalis
+type PolicyOptions struct {
+	Name string `json:"name"`
+	// Radiateur concerné (tous les radiateurs si absent)
+	ApplianceID int `json:"appliance_id"`
+	// Bornes des consignes TEMPERATURE. Avec un minimum, les presets Eco et Hors-Gel (forçage fenêtre compris)
+	// sont envoyés comme consigne TEMPERATURE au minimum, ou bloqués ; de même pour Confort avec un maximum
+	MinTemperature float64 `json:"min_temperature"`
+	MaxTemperature float64 `json:"max_temperature"`
+	// Interdit l'extinction du radiateur
+	ForbidOff bool `json:"forbid_off"`
+	// Modes Voltalis interdits, séparés par des virgules (CONFORT, ECO, HORS_GEL, TEMPERATURE)
+	ForbiddenModes string `json:"forbidden_modes"`
+	// Programmes dont l'activation est interdite, séparés par des virgules
+	ForbiddenPrograms string `json:"forbidden_programs"`
+	// "adjust" (par défaut) ramène la consigne dans les bornes, "block" refuse la commande.
+	// Un mode interdit ou une extinction est toujours bloqué
+	Action string `json:"action"`
+}
+
+// HeaterOptions regroupe les réglages propres à un radiateur, identifié par son ID d'appliance Voltalis
+type HeaterOptions struct {
+	ApplianceID int `json:"appliance_id"`
+
+	// Consigne proposée au premier passage en mode manuel, avant qu'une consigne n'ait été mémorisée (18 par défaut)
+	DefaultTemperature float64 `json:"default_temperature"`
+	// Consignes associées aux presets : si elles sont définies, le preset est envoyé comme consigne TEMPERATURE
+	// au lieu de s'appuyer sur les consignes internes du radiateur
+	ConfortTemperature float64 `json:"confort_temperature"`
+	EcoTemperature     float64 `json:"eco_temperature"`
+	HorsGelTemperature float64 `json:"hors_gel_temperature"`
+	// Plage et pas de la consigne saisie dans HA (15 à 25 par pas de 0.5 à défaut)
+	MinTemperature  float64 `json:"min_temperature"`
+	MaxTemperature  float64 `json:"max_temperature"`
+	TemperatureStep float64 `json:"temperature_step"`
+
+	// Capteur de température de la pièce : topic MQTT ou entité HA (via l'API du superviseur)
+	RoomTemperatureTopic  string `json:"room_temperature_topic"`
+	RoomTemperatureEntity string `json:"room_temperature_entity"`
+	// Unité des valeurs du capteur ("°C" par défaut, ou "°F")
+	RoomTemperatureUnit string `json:"room_temperature_unit"`
+	// Délai en minutes au-delà duquel une mesure est considérée comme périmée (30 par défaut)
+	RoomTemperatureMaxAge int `json:"room_temperature_max_age"`
+
+	// Régulation en boucle fermée sur la sonde de pièce lorsque le radiateur est en mode heat
+	Regulation bool `json:"regulation"`
+	// "preset" (bascule Confort/Eco, par défaut) ou "temperature" (consigne TEMPERATURE décalée)
+	RegulationStrategy string `json:"regulation_strategy"`
+	// Hystérésis en °C autour de la consigne (0.3 par défaut)
+	RegulationHysteresis float64 `json:"regulation_hysteresis"`
+	// Décalage en °C appliqué à la consigne en stratégie "temperature" (2 par défaut)
+	RegulationOffset float64 `json:"regulation_offset"`
+	// Durées minimales en minutes entre deux bascules chauffe/arrêt (10 par défaut)
+	RegulationMinOn  int `json:"regulation_min_on"`
+	RegulationMinOff int `json:"regulation_min_off"`
+
+	// Capteur d'ouverture (topic MQTT) forçant le Hors-Gel quand la fenêtre reste ouverte
+	WindowSensorTopic string `json:"window_sensor_topic"`
+	// Délai en secondes avant de forcer le Hors-Gel (120 par défaut)
+	WindowOpenDelay int `json:"window_open_delay"`
+	// Durée maximale en minutes du Hors-Gel forcé, par sécurité si la fermeture n'est jamais reçue (240 par défaut)
+	WindowMaxDuration int `json:"window_max_duration"`
+}
+
+// Heater retourne les options du radiateur demandé (valeurs vides s'il n'est pas configuré)
+func (o *Options) Heater(applianceID int) HeaterOptions {
+	for _, heater := range o.Heaters {
+		if heater.ApplianceID == applianceID {
+			return heater
+		}
+	}
+	return HeaterOptions{ApplianceID: applianceID}
 }
 
 func LoadOptions() (*Options, error) {
@@ -33,6 +132,9 @@ func LoadOptions() (*Options, error) {
 	if err := yaml.Unmarshal(data, &opts); err != nil {
 		return nil, fmt.Errorf("erreur de parsing JSON: %w", err)
 	}
+	if opts.StateDir == "" {
+		opts.StateDir = "/config/voltalis"
+	}
 
 	return &opts, nil
 }
@@ -0,0 +1,75 @@
+package homeassistant
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Client interroge l'API REST de Home Assistant via le proxy du superviseur (homeassistant_api: true)
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Token      string
+}
+
+// EntityState représente l'état d'une entité Home Assistant
+type EntityState struct {
+	EntityID    string         `json:"entity_id"`
+	State       string         `json:"state"`
+	Attributes  map[string]any `json:"attributes"`
+	LastUpdated time.Time      `json:"last_updated"`
+}
+
+// NewClient crée un client à partir du jeton fourni par le superviseur.
+// Sans jeton (exécution hors add-on), le client est créé mais tous les appels échouent
+func NewClient() *Client {
+	return &Client{
+		BaseURL:    "http://supervisor/core/api",
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Token:      os.Getenv("SUPERVISOR_TOKEN"),
+	}
+}
+
+// Available indique si l'API Home Assistant est joignable depuis l'add-on
+func (c *Client) Available() bool {
+	return c.Token != ""
+}
+
+func (c *Client) get(path string, out interface{}) error {
+	if !c.Available() {
+		return fmt.Errorf("API Home Assistant indisponible: SUPERVISOR_TOKEN non défini")
+	}
+	req, _ := http.NewRequest("GET", c.BaseURL+path, nil)
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s failed: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// GetState récupère l'état courant d'une entité
+func (c *Client) GetState(entityID string) (*EntityState, error) {
+	var s EntityState
+	err := c.get("/states/"+entityID, &s)
+	return &s, err
+}
+
+// Config représente la configuration générale de Home Assistant
+type Config struct {
+	TimeZone string `json:"time_zone"`
+}
+
+// GetConfig récupère la configuration générale (fuseau horaire notamment)
+func (c *Client) GetConfig() (*Config, error) {
+	var cfg Config
+	err := c.get("/config", &cfg)
+	return &cfg, err
+}
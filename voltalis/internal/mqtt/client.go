@@ -22,6 +22,19 @@ type Client struct {
 	stateTopicMap map[SetTopic]string // possède la dernière valeur set par HA sur chaque topic
 	StateManager  *StateManager       // machine à état de plus haut niveau ne renvoyant à l'exterieur que les données à renvoyer à voltalis
 
+	// DeviceDiscovery active la découverte HA par device (un seul message par appareil, HA 2024.11+)
+	// au lieu d'un message de configuration par entité
+	DeviceDiscovery bool
+	// JSONState regroupe les états de chaque radiateur (et du contrôleur) dans un unique document JSON
+	JSONState bool
+	// ReadOnly rejette toutes les commandes reçues de HA (les entités restent exposées)
+	ReadOnly bool
+	// Location est le fuseau horaire du site, utilisé pour interpréter les dates saisies sans fuseau (heure du conteneur si nil)
+	Location       *time.Location
+	documentsMutex sync.Mutex
+	documentFields map[GetTopic]documentField
+	published      map[GetTopic]any // dernière valeur publiée sur chaque topic d'état, renvoyée quand une commande est rejetée
+
 	// Pour la gestion des réabonnements après reconnexion
 	subscriptionsMutex sync.Mutex
 	subscriptions      []subscriptionInfo
@@ -31,8 +44,10 @@ type Client struct {
 func InitClient(broker string, clientID string, username string, password string) (*Client, error) {
 	// Créer le wrapper client d'abord
 	c := &Client{
-		stateTopicMap: make(map[SetTopic]string),
-		subscriptions: make([]subscriptionInfo, 0),
+		stateTopicMap:  make(map[SetTopic]string),
+		subscriptions:  make([]subscriptionInfo, 0),
+		documentFields: make(map[GetTopic]documentField),
+		published:      make(map[GetTopic]any),
 	}
 
 	opts := mqtt.NewClientOptions().
@@ -121,6 +136,14 @@ func (c *Client) GetTopicState(topic SetTopic) string {
 	return c.stateTopicMap[topic]
 }
 
+// location retourne le fuseau du site, ou celui du conteneur s'il n'a pas été configuré
+func (c *Client) location() *time.Location {
+	if c.Location == nil {
+		return time.Local
+	}
+	return c.Location
+}
+
 func (c *Client) buildClimateCommands(id int64) ClimateCommandPayload {
 	return ClimateCommandPayload{
 		ModeCommandTopic:        NewHeaterTopic[SetTopic](id, "mode"),
@@ -149,9 +172,14 @@ func (c *Client) BuildControllerCommandTopic() ControllerSetTopics {
 
 func (c *Client) BuildControllerStateTopic() ControllerGetTopics {
 	return ControllerGetTopics{
-		Mode:     getPayloadSelectMode(CONTROLLER_DEVICE, PRESET_SELECT_CONTROLLER...).StateTopic,
-		Duration: getPayloadSelectDuration(CONTROLLER_DEVICE).StateTopic,
-		Program:  getPayloadSelectProgram().StateTopic,
+		Mode:           getPayloadSelectMode(CONTROLLER_DEVICE, PRESET_SELECT_CONTROLLER...).StateTopic,
+		Duration:       getPayloadSelectDuration(CONTROLLER_DEVICE).StateTopic,
+		Program:        getPayloadSelectProgram().StateTopic,
+		EndDate:        getPayloadEndDate(CONTROLLER_DEVICE).StateTopic,
+		Remaining:      getPayloadRemainingTime(CONTROLLER_DEVICE).StateTopic,
+		Errors:         getPayloadErrorEvent(CONTROLLER_DEVICE).StateTopic,
+		CustomDuration: getPayloadCustomDuration(CONTROLLER_DEVICE).StateTopic,
+		CustomEndDate:  getPayloadCustomEndDate(CONTROLLER_DEVICE).StateTopic,
 	}
 }
 
@@ -163,6 +191,7 @@ func (c *Client) BuildHeaterCommandTopic(id int64) HeaterSetTopics {
 		PresetMode:     climate.PresetModeCommandTopic,
 		Temperature:    climate.TemperatureCommandTopic,
 		SingleDuration: durationPayload.CommandTopic,
+		ResumeProgram:  getPayloadResumeProgramButton(buildDeviceInfo(id, "")).CommandTopic,
 	}
 }
 
@@ -170,10 +199,19 @@ func (c *Client) BuildHeaterStateTopic(id int64) HeaterGetTopics {
 	climate := c.buildClimateStates(id)
 	durationPayload := getPayloadSelectDuration(buildDeviceInfo(id, ""))
 	return HeaterGetTopics{
-		Mode:           climate.ModeStateTopic,
-		PresetMode:     climate.PresetModeStateTopic,
-		Temperature:    climate.TemperatureStateTopic,
-		SingleDuration: durationPayload.StateTopic,
-		Action:         NewHeaterTopic[GetTopic](id, "action"),
+		Mode:               climate.ModeStateTopic,
+		PresetMode:         climate.PresetModeStateTopic,
+		Temperature:        climate.TemperatureStateTopic,
+		SingleDuration:     durationPayload.StateTopic,
+		Action:             NewHeaterTopic[GetTopic](id, "action"),
+		CurrentTemperature: climate.CurrentTemperatureTopic,
+		Attributes:         NewHeaterTopic[GetTopic](id, "attributes"),
+		BoostRemaining:     getPayloadBoostRemaining(buildDeviceInfo(id, "")).StateTopic,
+		EndDate:            getPayloadEndDate(buildDeviceInfo(id, "")).StateTopic,
+		Remaining:          getPayloadRemainingTime(buildDeviceInfo(id, "")).StateTopic,
+		Errors:             getPayloadErrorEvent(buildDeviceInfo(id, "")).StateTopic,
+		ExternalChange:     getPayloadExternalChangeEvent(buildDeviceInfo(id, "")).StateTopic,
+		CustomDuration:     getPayloadCustomDuration(buildDeviceInfo(id, "")).StateTopic,
+		CustomEndDate:      getPayloadCustomEndDate(buildDeviceInfo(id, "")).StateTopic,
 	}
 }
@@ -2,8 +2,6 @@ package mqtt
 
 import (
 	"fmt"
-	"maps"
-	"slices"
 )
 
 type Topic interface{ GetTopic | SetTopic }
@@ -37,17 +35,95 @@ func getPayloadSelectDuration(device DeviceInfo) *SelectConfigPayload[string] {
 		Name:         "Sélectionner la durée",
 		CommandTopic: newTopicName[SetTopic](identifier),
 		StateTopic:   newTopicName[GetTopic](identifier),
-		Options:      slices.Sorted(maps.Keys(DURATION_NAMES_TO_VALUES)),
+		Options:      DURATION_OPTIONS,
 		Device:       device,
 	}
 }
 
-func getPayloadDureeMode(device DeviceInfo, topic GetTopic) *SensorConfigPayload {
-	identifier := device.Identifiers[0] + "_state"
+func getPayloadCustomDuration(device DeviceInfo) *NumberConfigPayload {
+	identifier := device.Identifiers[0] + "_custom_duration"
+	return &NumberConfigPayload{
+		UniqueID:          identifier,
+		Name:              "Durée personnalisée",
+		CommandTopic:      newTopicName[SetTopic](identifier),
+		StateTopic:        newTopicName[GetTopic](identifier),
+		Min:               0,
+		Max:               7 * 24 * 60,
+		Step:              1,
+		Mode:              "box",
+		UnitOfMeasurement: "min",
+		Device:            device,
+	}
+}
+
+func getPayloadCustomEndDate(device DeviceInfo) *TextConfigPayload {
+	identifier := device.Identifiers[0] + "_custom_end_date"
+	return &TextConfigPayload{
+		UniqueID:     identifier,
+		Name:         "Fin du mode (date/heure)",
+		CommandTopic: newTopicName[SetTopic](identifier),
+		StateTopic:   newTopicName[GetTopic](identifier),
+		Pattern:      `^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}.*$`,
+		Device:       device,
+	}
+}
+
+// legacyDurationStateIdentifier est le suffixe de l'ancien capteur "Durée mode", qui recopiait la date de fin brute de Voltalis
+const legacyDurationStateIdentifier = "_state"
+
+func getPayloadEndDate(device DeviceInfo) *SensorConfigPayload {
+	identifier := device.Identifiers[0] + "_end_date"
+	return &SensorConfigPayload{
+		UniqueID:    identifier,
+		Name:        "Fin du mode en cours",
+		StateTopic:  newTopicName[GetTopic](identifier),
+		DeviceClass: "timestamp",
+		Device:      device,
+	}
+}
+
+func getPayloadRemainingTime(device DeviceInfo) *SensorConfigPayload {
+	identifier := device.Identifiers[0] + "_remaining"
+	return &SensorConfigPayload{
+		UniqueID:          identifier,
+		Name:              "Temps restant",
+		StateTopic:        newTopicName[GetTopic](identifier),
+		UnitOfMeasurement: "min",
+		DeviceClass:       "duration",
+		Device:            device,
+	}
+}
+
+func getPayloadBoostRemaining(device DeviceInfo) *SensorConfigPayload {
+	identifier := device.Identifiers[0] + "_boost_remaining"
 	return &SensorConfigPayload{
+		UniqueID:          identifier,
+		Name:              "Boost restant",
+		StateTopic:        newTopicName[GetTopic](identifier),
+		UnitOfMeasurement: "min",
+		DeviceClass:       "duration",
+		Device:            device,
+	}
+}
+
+func getPayloadErrorEvent(device DeviceInfo) *EventConfigPayload {
+	identifier := device.Identifiers[0] + "_errors"
+	return &EventConfigPayload{
 		UniqueID:   identifier,
-		Name:       "Durée mode",
-		StateTopic: topic,
+		Name:       "Erreurs",
+		StateTopic: newTopicName[GetTopic](identifier),
+		EventTypes: ERROR_EVENT_TYPES,
+		Device:     device,
+	}
+}
+
+func getPayloadExternalChangeEvent(device DeviceInfo) *EventConfigPayload {
+	identifier := device.Identifiers[0] + "_external_changes"
+	return &EventConfigPayload{
+		UniqueID:   identifier,
+		Name:       "Changements externes",
+		StateTopic: newTopicName[GetTopic](identifier),
+		EventTypes: []string{EventExternalChange},
 		Device:     device,
 	}
 }
@@ -62,6 +138,16 @@ func getPayloadRefreshButton(device DeviceInfo) *ButtonConfigPayload {
 	}
 }
 
+func getPayloadResumeProgramButton(device DeviceInfo) *ButtonConfigPayload {
+	identifier := device.Identifiers[0] + "_resume_program"
+	return &ButtonConfigPayload{
+		UniqueID:     identifier,
+		Name:         "Revenir à la programmation",
+		CommandTopic: newTopicName[SetTopic](identifier),
+		Device:       device,
+	}
+}
+
 func getPayloadSelectProgram(options ...string) *SelectConfigPayload[string] {
 	identifier := CONTROLLER_DEVICE.Identifiers[0] + "_program"
 	return &SelectConfigPayload[string]{
@@ -2,6 +2,7 @@ package mqtt
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/francois76/voltalis-integration/voltalis/internal/state"
 )
@@ -19,7 +20,16 @@ func (c *Client) RegisterController() (*Controller, error) {
 		Client:    c,
 		GetTopics: ControllerGetTopics{},
 		SetTopics: ControllerSetTopics{},
+		discovery: newDeviceDiscovery(c, CONTROLLER_DEVICE),
 	}
+	stateTopics := c.BuildControllerStateTopic()
+	c.bindStateDocument(newTopicName[GetTopic](CONTROLLER_DEVICE.Identifiers[0]+"_json"), map[GetTopic]string{
+		stateTopics.Mode:      "mode",
+		stateTopics.Duration:  "duration",
+		stateTopics.Program:   "program",
+		stateTopics.EndDate:   "end_date",
+		stateTopics.Remaining: "remaining",
+	})
 
 	if err := controller.addSelectMode(); err != nil {
 		return nil, err
@@ -27,6 +37,9 @@ func (c *Client) RegisterController() (*Controller, error) {
 	if err := controller.addSelectDuration(); err != nil {
 		return nil, err
 	}
+	if err := controller.addCustomDuration(); err != nil {
+		return nil, err
+	}
 
 	if err := controller.AddSelectProgram(); err != nil {
 		return nil, err
@@ -34,29 +47,52 @@ func (c *Client) RegisterController() (*Controller, error) {
 	if err := controller.addRefreshController(); err != nil {
 		return nil, err
 	}
-	err := controller.addDurationState(controller.GetTopics.Duration)
-	if err != nil {
+	if err := controller.addResumeProgram(); err != nil {
+		return nil, err
+	}
+	if err := controller.addErrorEvent(); err != nil {
 		return nil, err
 	}
-	controller.ListenState(controller.SetTopics.Mode, func(currentState *state.ResourceState, data string) {
+	if err := controller.addEndDate(); err != nil {
+		return nil, err
+	}
+	if err := controller.discovery.commit(); err != nil {
+		return nil, err
+	}
+	controller.listen(controller.SetTopics.Mode, oneOf(PRESET_SELECT_CONTROLLER...), func(currentState *state.ResourceState, data string) {
 		currentState.ControllerState.Mode = state.HeaterPresetMode(data)
 	})
-	controller.ListenState(controller.SetTopics.Duration, func(currentState *state.ResourceState, data string) {
+	controller.listen(controller.SetTopics.Duration, validateDuration, func(currentState *state.ResourceState, data string) {
 		currentState.ControllerState.Duration = data
 	})
-	controller.ListenState(controller.SetTopics.Program, func(currentState *state.ResourceState, data string) {
+	controller.listen(controller.SetTopics.CustomDuration, validateCustomDuration, func(currentState *state.ResourceState, data string) {
+		currentState.ControllerState.Duration, _ = CustomDurationName(data)
+	})
+	controller.listen(controller.SetTopics.CustomEndDate, validateCustomEndDate(controller.location), func(currentState *state.ResourceState, data string) {
+		currentState.ControllerState.Duration, _ = CustomEndDateName(data, controller.location())
+	})
+	controller.listen(controller.SetTopics.Program, controller.validateProgram, func(currentState *state.ResourceState, data string) {
 		currentState.ControllerState.Program = data
 	})
 	return controller, nil
 }
 
-func (controller *Controller) addDurationState(topic GetTopic) error {
-	statePayload := getPayloadDureeMode(CONTROLLER_DEVICE, topic)
-	if err := controller.PublishConfig(statePayload); err != nil {
-		return fmt.Errorf("failed to publish controller state config: %w", err)
+// addEndDate déclare les capteurs de fin du mode du contrôleur : horodatage de fin et minutes restantes
+func (controller *Controller) addEndDate() error {
+	if err := controller.removeConfig(ComponentSensor, CONTROLLER_DEVICE.Identifiers[0]+legacyDurationStateIdentifier); err != nil {
+		return fmt.Errorf("failed to remove legacy controller state config: %w", err)
+	}
+	endDatePayload := getPayloadEndDate(CONTROLLER_DEVICE)
+	if err := controller.PublishConfig(endDatePayload); err != nil {
+		return fmt.Errorf("failed to publish controller end date config: %w", err)
+	}
+	controller.GetTopics.EndDate = endDatePayload.StateTopic
+
+	remainingPayload := getPayloadRemainingTime(CONTROLLER_DEVICE)
+	if err := controller.PublishConfig(remainingPayload); err != nil {
+		return fmt.Errorf("failed to publish controller remaining time config: %w", err)
 	}
-	controller.GetTopics.State = statePayload.StateTopic
-	controller.PublishState(statePayload.StateTopic, "Initialisation de l'intégration voltalis...")
+	controller.GetTopics.Remaining = remainingPayload.StateTopic
 	return nil
 }
 
@@ -69,6 +105,26 @@ func (controller *Controller) addRefreshController() error {
 	return nil
 }
 
+// addResumeProgram déclare le bouton qui ramène tous les radiateurs à la programmation
+func (controller *Controller) addResumeProgram() error {
+	resumePayload := getPayloadResumeProgramButton(CONTROLLER_DEVICE)
+	if err := controller.PublishConfig(resumePayload); err != nil {
+		return fmt.Errorf("failed to publish controller resume program config: %w", err)
+	}
+	controller.SetTopics.ResumeProgram = resumePayload.CommandTopic
+	return nil
+}
+
+// addErrorEvent déclare l'entité event signalant les commandes globales refusées par Voltalis
+func (controller *Controller) addErrorEvent() error {
+	eventPayload := getPayloadErrorEvent(CONTROLLER_DEVICE)
+	if err := controller.PublishConfig(eventPayload); err != nil {
+		return fmt.Errorf("failed to publish controller error event config: %w", err)
+	}
+	controller.GetTopics.Errors = eventPayload.StateTopic
+	return nil
+}
+
 func (controller *Controller) AddSelectProgram(options ...string) error {
 	programPayload := getPayloadSelectProgram(options...)
 	if err := controller.PublishConfig(programPayload); err != nil {
@@ -76,6 +132,39 @@ func (controller *Controller) AddSelectProgram(options ...string) error {
 	}
 	controller.GetTopics.Program = programPayload.StateTopic
 	controller.SetTopics.Program = programPayload.CommandTopic
+	controller.programsMutex.Lock()
+	controller.programs = programPayload.Options
+	controller.programsMutex.Unlock()
+	return nil
+}
+
+// validateProgram accepte uniquement les programmes proposés par le select
+func (controller *Controller) validateProgram(data string) (string, error) {
+	controller.programsMutex.Lock()
+	programs := controller.programs
+	controller.programsMutex.Unlock()
+	return oneOf(programs...)(data)
+}
+
+// listen écoute un topic de commande du contrôleur ; les commandes rejetées sont signalées sur son entité "Erreurs"
+func (controller *Controller) listen(topic SetTopic, validate Validator, publishState func(currentState *state.ResourceState, data string)) {
+	controller.ListenStateWithValidation(topic, validate, controller.GetTopics.Errors, nil, publishState)
+}
+
+func (c *Controller) addCustomDuration() error {
+	durationPayload := getPayloadCustomDuration(CONTROLLER_DEVICE)
+	if err := c.PublishConfig(durationPayload); err != nil {
+		return fmt.Errorf("failed to publish controller custom duration config: %w", err)
+	}
+	c.SetTopics.CustomDuration = durationPayload.CommandTopic
+	c.GetTopics.CustomDuration = durationPayload.StateTopic
+
+	endDatePayload := getPayloadCustomEndDate(CONTROLLER_DEVICE)
+	if err := c.PublishConfig(endDatePayload); err != nil {
+		return fmt.Errorf("failed to publish controller custom end date config: %w", err)
+	}
+	c.SetTopics.CustomEndDate = endDatePayload.CommandTopic
+	c.GetTopics.CustomEndDate = endDatePayload.StateTopic
 	return nil
 }
 
@@ -100,20 +189,36 @@ func (c *Controller) addSelectMode() error {
 }
 
 type ControllerSetTopics struct {
-	Mode     SetTopic
-	Duration SetTopic
-	Program  SetTopic
-	Refresh  SetTopic
+	Mode           SetTopic
+	Duration       SetTopic
+	Program        SetTopic
+	Refresh        SetTopic
+	ResumeProgram  SetTopic
+	CustomDuration SetTopic
+	CustomEndDate  SetTopic
 }
 type ControllerGetTopics struct {
-	Mode     GetTopic
-	Duration GetTopic
-	Program  GetTopic
-	State    GetTopic
+	Mode           GetTopic
+	Duration       GetTopic
+	Program        GetTopic
+	EndDate        GetTopic
+	Remaining      GetTopic
+	Errors         GetTopic
+	CustomDuration GetTopic
+	CustomEndDate  GetTopic
 }
 
 type Controller struct {
 	*Client
 	SetTopics ControllerSetTopics
 	GetTopics ControllerGetTopics
+	discovery *deviceDiscovery
+
+	programsMutex sync.Mutex
+	programs      []string // options du select de programme
+}
+
+// PublishConfig publie la configuration d'une entité du contrôleur, directement ou via le device selon le mode de découverte
+func (controller *Controller) PublishConfig(payload payload) error {
+	return controller.discovery.add(payload)
 }
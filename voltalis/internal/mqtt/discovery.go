@@ -0,0 +1,102 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+var ORIGIN = OriginInfo{
+	Name:       "voltalis-addon",
+	SwVersion:  "0.1.0",
+	SupportURL: "https://github.com/francois76/voltalis-integration",
+}
+
+// deviceDiscovery collecte les payloads de configuration des entités d'un même device.
+// En mode découverte par entité, chaque payload est publié immédiatement sur son propre topic.
+// En mode découverte par device (HA 2024.11+), les payloads sont regroupés dans un unique
+// message homeassistant/device/<id>/config publié par commit().
+type deviceDiscovery struct {
+	client     *Client
+	device     DeviceInfo
+	components map[string]payload
+	committed  bool
+}
+
+func newDeviceDiscovery(c *Client, device DeviceInfo) *deviceDiscovery {
+	return &deviceDiscovery{
+		client:     c,
+		device:     device,
+		components: make(map[string]payload),
+	}
+}
+
+// add enregistre la configuration d'une entité du device.
+// Si le device a déjà été publié, il est republié en entier pour prendre en compte la modification
+func (d *deviceDiscovery) add(p payload) error {
+	if documented, ok := p.(documentedPayload); ok {
+		p = documented.withStateDocument(d.client)
+	}
+	if !d.client.DeviceDiscovery {
+		return d.client.PublishConfig(p)
+	}
+	// La configuration par entité d'une exécution précédente dupliquerait l'entité dans HA
+	if err := d.client.removeConfig(p.getComponent(), p.getIdentifier()); err != nil {
+		return fmt.Errorf("failed to remove entity config %s: %w", p.getIdentifier(), err)
+	}
+	d.components[p.getIdentifier()] = p
+	if d.committed {
+		return d.commit()
+	}
+	return nil
+}
+
+// commit publie la configuration complète du device. En mode découverte par entité,
+// la configuration de device retenue d'une exécution précédente est supprimée
+func (d *deviceDiscovery) commit() error {
+	if !d.client.DeviceDiscovery {
+		if err := d.client.publish(d.topic(), true, ""); err != nil {
+			return fmt.Errorf("failed to remove device config: %w", err)
+		}
+		return nil
+	}
+	devicePayload := DeviceConfigPayload{
+		Device:     d.device,
+		Origin:     ORIGIN,
+		Components: make(map[string]map[string]any, len(d.components)),
+	}
+	for _, id := range slices.Sorted(maps.Keys(d.components)) {
+		component, err := toDeviceComponent(d.components[id])
+		if err != nil {
+			return err
+		}
+		devicePayload.Components[id] = component
+	}
+	if err := d.client.publish(d.topic(), true, devicePayload); err != nil {
+		return fmt.Errorf("failed to publish device config: %w", err)
+	}
+	d.committed = true
+	return nil
+}
+
+// topic retourne le topic de découverte du device
+func (d *deviceDiscovery) topic() string {
+	return fmt.Sprintf("homeassistant/device/%s/config", d.device.Identifiers[0])
+}
+
+// toDeviceComponent convertit un payload d'entité en composant de device :
+// la plateforme devient un champ du payload et le device est porté par le message englobant
+func toDeviceComponent(p payload) (map[string]any, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal component %s: %w", p.getIdentifier(), err)
+	}
+	component := map[string]any{}
+	if err := json.Unmarshal(data, &component); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal component %s: %w", p.getIdentifier(), err)
+	}
+	delete(component, "device")
+	component["platform"] = p.getComponent()
+	return component, nil
+}
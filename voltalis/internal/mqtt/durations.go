@@ -0,0 +1,152 @@
+package mqtt
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Préfixe des durées exprimées par une date de fin absolue (entité texte "Fin du mode")
+const endDatePrefix = "Jusqu'au "
+
+var durationNamePattern = regexp.MustCompile(`^Pendant (\d+) (minute|heure|jour)s?$`)
+
+var durationUnits = map[string]time.Duration{
+	"minute": time.Minute,
+	"heure":  time.Hour,
+	"jour":   24 * time.Hour,
+}
+
+// ConfigureDurations remplace les options du select de durée par celles des options de l'add-on
+// (ex: "30m", "2h", "1d"). Doit être appelé avant la déclaration des entités
+func ConfigureDurations(options []string) error {
+	if len(options) == 0 {
+		return nil
+	}
+	durations := make([]time.Duration, 0, len(options))
+	for _, option := range options {
+		d, err := parseDurationOption(option)
+		if err != nil {
+			return err
+		}
+		durations = append(durations, d)
+	}
+	setDurationOptions(durations)
+	return nil
+}
+
+func setDurationOptions(durations []time.Duration) {
+	DURATION_NAMES_TO_VALUES = map[string]time.Duration{DURATION_UNTIL_FURTHER_NOTICE: 0}
+	DURATION_OPTIONS = []string{DURATION_UNTIL_FURTHER_NOTICE}
+	for _, d := range durations {
+		name := DurationName(d)
+		if _, exists := DURATION_NAMES_TO_VALUES[name]; exists {
+			continue
+		}
+		DURATION_NAMES_TO_VALUES[name] = d
+		DURATION_OPTIONS = append(DURATION_OPTIONS, name)
+	}
+}
+
+// parseDurationOption accepte les durées Go ("90m", "2h30m") ainsi que les jours ("1d")
+func parseDurationOption(option string) (time.Duration, error) {
+	option = strings.TrimSpace(option)
+	if days, ok := strings.CutSuffix(option, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("durée invalide: %q", option)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(option)
+	if err != nil || d < time.Minute {
+		return 0, fmt.Errorf("durée invalide: %q", option)
+	}
+	return d.Round(time.Minute), nil
+}
+
+// DurationName retourne le libellé d'une durée, dans l'unité la plus grande qui l'exprime exactement
+func DurationName(d time.Duration) string {
+	if d <= 0 {
+		return DURATION_UNTIL_FURTHER_NOTICE
+	}
+	n, unit := int64(d/time.Minute), "minute"
+	switch {
+	case d%(24*time.Hour) == 0:
+		n, unit = int64(d/(24*time.Hour)), "jour"
+	case d%time.Hour == 0:
+		n, unit = int64(d/time.Hour), "heure"
+	}
+	plural := "s"
+	if n == 1 {
+		plural = ""
+	}
+	return fmt.Sprintf("Pendant %d %s%s", n, unit, plural)
+}
+
+// EndDateName retourne le libellé d'une durée définie par une date de fin absolue
+func EndDateName(end time.Time) string {
+	return endDatePrefix + end.Format(time.RFC3339)
+}
+
+// IsDurationOption indique si un libellé fait partie des options du select de durée
+func IsDurationOption(name string) bool {
+	_, ok := DURATION_NAMES_TO_VALUES[name]
+	return ok
+}
+
+// ParseDuration retourne la durée relative correspondant à un libellé (0 si jusqu'à nouvel ordre ou inconnu)
+func ParseDuration(name string) time.Duration {
+	if d, ok := DURATION_NAMES_TO_VALUES[name]; ok {
+		return d
+	}
+	if match := durationNamePattern.FindStringSubmatch(name); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		return time.Duration(n) * durationUnits[match[2]]
+	}
+	return 0
+}
+
+// ParseEndDate calcule la date de fin correspondant à une durée choisie dans HA.
+// Retourne nil pour "jusqu'à ce que je change d'avis" ou une durée inconnue,
+// et une erreur pour une date de fin illisible ou déjà passée
+func ParseEndDate(name string, now time.Time) (*time.Time, error) {
+	if value, ok := strings.CutPrefix(name, endDatePrefix); ok {
+		end, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("date de fin invalide: %q", value)
+		}
+		if !end.After(now) {
+			return nil, fmt.Errorf("date de fin %s déjà passée", end.Format(time.RFC3339))
+		}
+		return &end, nil
+	}
+	if d := ParseDuration(name); d > 0 {
+		end := now.Add(d)
+		return &end, nil
+	}
+	return nil, nil
+}
+
+// CustomDurationName convertit la valeur de l'entité "Durée personnalisée" (en minutes) en libellé de durée
+func CustomDurationName(minutes string) (string, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(minutes), 64)
+	if err != nil || value < 0 {
+		return "", fmt.Errorf("durée en minutes invalide: %q", minutes)
+	}
+	return DurationName(time.Duration(value * float64(time.Minute)).Round(time.Minute)), nil
+}
+
+// CustomEndDateName convertit la valeur de l'entité "Fin du mode" (date/heure ISO 8601) en libellé de durée
+func CustomEndDateName(value string, location *time.Location) (string, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		end, err := time.ParseInLocation(layout, value, location)
+		if err == nil {
+			return EndDateName(end), nil
+		}
+	}
+	return "", fmt.Errorf("date de fin invalide: %q", value)
+}
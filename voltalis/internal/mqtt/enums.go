@@ -1,23 +1,11 @@
 package mqtt
 
 import (
-	"fmt"
 	"time"
 )
 
 func init() {
-	during := func(n int64, unit string) string {
-		plural := "s"
-		if n == 1 {
-			plural = ""
-		}
-		return fmt.Sprintf("Pendant %d %s%s", n, unit, plural)
-	}
-	for _, i := range []int64{1, 2, 3, 4} {
-		DURATION_NAMES_TO_VALUES[during(i, "heure")] = time.Duration(i) * time.Hour
-	}
-	DURATION_NAMES_TO_VALUES["Jusqu'à ce que je change d'avis"] = time.Duration(0)
-
+	setDurationOptions([]time.Duration{1 * time.Hour, 2 * time.Hour, 3 * time.Hour, 4 * time.Hour})
 }
 
 // Modes pour les radiateurs Voltalis
@@ -38,12 +26,13 @@ const (
 	HeaterPresetModeEco       HeaterPresetMode = "Eco"
 	HeaterPresetModeHorsGel   HeaterPresetMode = "Hors-Gel"
 	HeaterPresetModeManuel    HeaterPresetMode = "Manuel"
+	HeaterPresetModeBoost     HeaterPresetMode = "Boost"
 	HeaterPresetModeAucunMode HeaterPresetMode = "Aucun mode"
 	HeaterPresetModeNone      HeaterPresetMode = "none"
 )
 
-var PRESET_SELECT_ONE_HEATER []HeaterPresetMode = []HeaterPresetMode{HeaterPresetModeConfort, HeaterPresetModeEco, HeaterPresetModeHorsGel}
-var PRESET_SELECT_CONTROLLER []HeaterPresetMode = []HeaterPresetMode{HeaterPresetModeConfort, HeaterPresetModeEco, HeaterPresetModeHorsGel, HeaterPresetModeAucunMode}
+var PRESET_SELECT_ONE_HEATER []HeaterPresetMode = []HeaterPresetMode{HeaterPresetModeConfort, HeaterPresetModeEco, HeaterPresetModeHorsGel, HeaterPresetModeBoost}
+var PRESET_SELECT_CONTROLLER []HeaterPresetMode = []HeaterPresetMode{HeaterPresetModeConfort, HeaterPresetModeEco, HeaterPresetModeHorsGel, HeaterPresetModeBoost, HeaterPresetModeAucunMode}
 
 type HeaterAction string
 
@@ -64,8 +53,35 @@ const (
 	ComponentSelect  component = "select"
 	ComponentSensor  component = "sensor"
 	ComponentButton  component = "button"
+	ComponentNumber  component = "number"
+	ComponentText    component = "text"
+	ComponentEvent   component = "event"
 )
 
+// Types d'événements émis sur l'entité "Erreurs" des radiateurs et du contrôleur
+const (
+	EventCommandFailed   = "command_failed"
+	EventCommandTimeout  = "command_timeout"
+	EventCommandRejected = "command_rejected"
+	EventPolicyViolation = "policy_violation"
+)
+
+var ERROR_EVENT_TYPES = []string{EventCommandFailed, EventCommandTimeout, EventCommandRejected, EventPolicyViolation}
+
+// EventExternalChange est émis sur l'entité "Changements externes" d'un radiateur modifié hors de Home Assistant
+const EventExternalChange = "external_change"
+
 var DURATION_NAMES_TO_VALUES = map[string]time.Duration{}
 
+// DURATION_OPTIONS liste les options du select de durée dans l'ordre d'affichage
+var DURATION_OPTIONS []string
+
+const DURATION_UNTIL_FURTHER_NOTICE = "Jusqu'à ce que je change d'avis"
+
 const TEMPERATURE_NONE = "None"
+
+// DEFAULT_MANUAL_TEMPERATURE est la consigne proposée au premier passage en mode manuel
+const DEFAULT_MANUAL_TEMPERATURE = 18.0
+
+// STATE_NONE est interprété par Home Assistant comme un état inconnu (capteur sans valeur)
+const STATE_NONE = "None"
@@ -8,13 +8,43 @@ import (
 	"github.com/francois76/voltalis-integration/voltalis/internal/state"
 )
 
-func (c *Client) RegisterHeater(id int64, name string) error {
+// HeaterSettings regroupe les réglages propres à un radiateur
+type HeaterSettings struct {
+	// Consigne proposée au premier passage en mode manuel, tant qu'aucune consigne n'a été mémorisée (DEFAULT_MANUAL_TEMPERATURE si 0)
+	DefaultTemperature float64
+	// Plage et pas de la consigne (DEFAULT_TEMPERATURE_LIMITS si non renseignés)
+	Limits TemperatureLimits
+}
+
+// RegisterHeater déclare un radiateur avec ses réglages propres
+func (c *Client) RegisterHeater(id int64, name string, settings HeaterSettings) error {
+	if !settings.Limits.Valid() {
+		settings.Limits = DEFAULT_TEMPERATURE_LIMITS
+	}
 	heater := Heater{
-		Client:    c,
-		GetTopics: HeaterGetTopics{},
-		SetTopics: HeaterSetTopics{},
+		Client:             c,
+		id:                 id,
+		defaultTemperature: settings.DefaultTemperature,
+		limits:             settings.Limits,
+		GetTopics:          HeaterGetTopics{},
+		SetTopics:          HeaterSetTopics{},
+		discovery:          newDeviceDiscovery(c, buildDeviceInfo(id, name)),
 	}
-	c.StateManager.currentState.HeaterState[id] = state.HeaterState{}
+	// L'état éventuellement rechargé depuis le disque est conservé
+	if _, known := c.StateManager.currentState.HeaterState[id]; !known {
+		c.StateManager.currentState.HeaterState[id] = state.HeaterState{}
+	}
+	stateTopics := c.BuildHeaterStateTopic(id)
+	c.bindStateDocument(NewHeaterTopic[GetTopic](id, "json"), map[GetTopic]string{
+		stateTopics.Mode:               "mode",
+		stateTopics.PresetMode:         "preset_mode",
+		stateTopics.Temperature:        "temperature",
+		stateTopics.CurrentTemperature: "current_temperature",
+		stateTopics.Action:             "action",
+		stateTopics.SingleDuration:     "duration",
+		stateTopics.EndDate:            "end_date",
+		stateTopics.Remaining:          "remaining",
+	})
 	payload, err := heater.addClimate(id, name)
 	if err != nil {
 		return err
@@ -28,7 +58,31 @@ func (c *Client) RegisterHeater(id int64, name string) error {
 		return err
 	}
 
-	if err := heater.addDurationState(payload, heater.GetTopics.SingleDuration); err != nil {
+	if err := heater.addEndDate(payload); err != nil {
+		return err
+	}
+
+	if err := heater.addBoostRemaining(payload); err != nil {
+		return err
+	}
+
+	if err := heater.addCustomDuration(payload); err != nil {
+		return err
+	}
+
+	if err := heater.addResumeProgram(payload); err != nil {
+		return err
+	}
+
+	if err := heater.addErrorEvent(payload); err != nil {
+		return err
+	}
+
+	if err := heater.addExternalChangeEvent(payload); err != nil {
+		return err
+	}
+
+	if err := heater.discovery.commit(); err != nil {
 		return err
 	}
 
@@ -38,32 +92,41 @@ func (c *Client) RegisterHeater(id int64, name string) error {
 		currentState.HeaterState[id] = heaterState
 	}
 
-	heater.ListenState(heater.SetTopics.Temperature, func(currentState *state.ResourceState, data string) {
+	// La consigne est arrondie au pas du radiateur et ramenée dans sa plage avant d'être appliquée
+	heater.listen(heater.SetTopics.Temperature, validateTemperature(heater.limits), nil, func(currentState *state.ResourceState, data string) {
 		updateHeater(currentState, data, func(heaterState *state.HeaterState, data string) {
-			dataFloat, err := strconv.ParseFloat(data, 64)
-			if err != nil {
-				heaterState.Temperature = -1
-			} else {
-				heaterState.Temperature = dataFloat
-			}
+			// La valeur a été validée : l'erreur de conversion ne peut pas se produire
+			temperature, _ := strconv.ParseFloat(data, 64)
+			heaterState.Temperature = temperature
+			heaterState.LastTemperature = temperature
 		})
 	})
-	heater.ListenState(heater.SetTopics.SingleDuration, func(currentState *state.ResourceState, data string) {
+	heater.listen(heater.SetTopics.SingleDuration, validateDuration, nil, func(currentState *state.ResourceState, data string) {
 		updateHeater(currentState, data, func(heaterState *state.HeaterState, data string) {
 			heaterState.Duration = data
 		})
 	})
+	heater.listen(heater.SetTopics.CustomDuration, validateCustomDuration, nil, func(currentState *state.ResourceState, data string) {
+		updateHeater(currentState, data, func(heaterState *state.HeaterState, data string) {
+			heaterState.Duration, _ = CustomDurationName(data)
+		})
+	})
+	heater.listen(heater.SetTopics.CustomEndDate, validateCustomEndDate(heater.location), nil, func(currentState *state.ResourceState, data string) {
+		updateHeater(currentState, data, func(heaterState *state.HeaterState, data string) {
+			heaterState.Duration, _ = CustomEndDateName(data, heater.location())
+		})
+	})
 
-	heater.ListenStateWithPreHook(heater.SetTopics.PresetMode, func(data string) {
+	// HA envoie "none" quand le preset est retiré du climate
+	heater.listen(heater.SetTopics.PresetMode, oneOf(append(PRESET_SELECT_ONE_HEATER, HeaterPresetModeNone)...), func(data string) {
 		heater.recomputeState(data)
 	}, func(currentState *state.ResourceState, data string) {
-		fmt.Println("test")
 		updateHeater(currentState, data, func(heaterState *state.HeaterState, data string) {
 			heaterState.PresetMode = state.HeaterPresetMode(data)
 		})
 	})
 
-	heater.ListenStateWithPreHook(heater.SetTopics.Mode, func(data string) {
+	heater.listen(heater.SetTopics.Mode, oneOf(HeaterModeOff, HeaterModeAuto, HeaterModeHeat), func(data string) {
 		switch HeaterMode(data) {
 		case HeaterModeOff:
 			heater.recomputeState(string(HeaterPresetModeNone))
@@ -80,18 +143,90 @@ func (c *Client) RegisterHeater(id int64, name string) error {
 	}, func(currentState *state.ResourceState, data string) {
 		updateHeater(currentState, data, func(heaterState *state.HeaterState, data string) {
 			heaterState.Mode = state.HeaterMode(data)
+			// Retour en mode manuel : on reprend la dernière consigne mémorisée
+			if heaterState.Mode == state.HeaterModeHeat && heaterState.Temperature <= 0 {
+				heaterState.Temperature = heater.manualTemperature()
+			}
 		})
 	})
 
 	return nil
 }
 
-func (h *Heater) addDurationState(payload *ClimateConfigPayload, topic GetTopic) error {
-	statePayload := getPayloadDureeMode(payload.Device, topic)
-	if err := h.PublishConfig(statePayload); err != nil {
-		return fmt.Errorf("failed to publish heater state config: %w", err)
+// addEndDate déclare les capteurs de fin du mode en cours : horodatage de fin et minutes restantes
+func (h *Heater) addEndDate(payload *ClimateConfigPayload) error {
+	if err := h.removeConfig(ComponentSensor, payload.Device.Identifiers[0]+legacyDurationStateIdentifier); err != nil {
+		return fmt.Errorf("failed to remove legacy heater state config: %w", err)
+	}
+	endDatePayload := getPayloadEndDate(payload.Device)
+	if err := h.PublishConfig(endDatePayload); err != nil {
+		return fmt.Errorf("failed to publish heater end date config: %w", err)
+	}
+	h.GetTopics.EndDate = endDatePayload.StateTopic
+
+	remainingPayload := getPayloadRemainingTime(payload.Device)
+	if err := h.PublishConfig(remainingPayload); err != nil {
+		return fmt.Errorf("failed to publish heater remaining time config: %w", err)
 	}
-	h.PublishState(statePayload.StateTopic, "Initialisation de l'intégration voltalis...")
+	h.GetTopics.Remaining = remainingPayload.StateTopic
+	return nil
+}
+
+func (h *Heater) addBoostRemaining(payload *ClimateConfigPayload) error {
+	boostPayload := getPayloadBoostRemaining(payload.Device)
+	if err := h.PublishConfig(boostPayload); err != nil {
+		return fmt.Errorf("failed to publish heater boost config: %w", err)
+	}
+	h.GetTopics.BoostRemaining = boostPayload.StateTopic
+	h.PublishState(boostPayload.StateTopic, 0)
+	return nil
+}
+
+// addCustomDuration déclare les entités de durée libre : un nombre de minutes et une date de fin absolue
+func (h *Heater) addCustomDuration(payload *ClimateConfigPayload) error {
+	durationPayload := getPayloadCustomDuration(payload.Device)
+	if err := h.PublishConfig(durationPayload); err != nil {
+		return fmt.Errorf("failed to publish heater custom duration config: %w", err)
+	}
+	h.SetTopics.CustomDuration = durationPayload.CommandTopic
+	h.GetTopics.CustomDuration = durationPayload.StateTopic
+
+	endDatePayload := getPayloadCustomEndDate(payload.Device)
+	if err := h.PublishConfig(endDatePayload); err != nil {
+		return fmt.Errorf("failed to publish heater custom end date config: %w", err)
+	}
+	h.SetTopics.CustomEndDate = endDatePayload.CommandTopic
+	h.GetTopics.CustomEndDate = endDatePayload.StateTopic
+	return nil
+}
+
+// addResumeProgram déclare le bouton qui annule le réglage manuel pour revenir à la programmation
+func (h *Heater) addResumeProgram(payload *ClimateConfigPayload) error {
+	resumePayload := getPayloadResumeProgramButton(payload.Device)
+	if err := h.PublishConfig(resumePayload); err != nil {
+		return fmt.Errorf("failed to publish heater resume program config: %w", err)
+	}
+	h.SetTopics.ResumeProgram = resumePayload.CommandTopic
+	return nil
+}
+
+// addErrorEvent déclare l'entité event signalant les commandes refusées ou non appliquées par Voltalis
+func (h *Heater) addErrorEvent(payload *ClimateConfigPayload) error {
+	eventPayload := getPayloadErrorEvent(payload.Device)
+	if err := h.PublishConfig(eventPayload); err != nil {
+		return fmt.Errorf("failed to publish heater error event config: %w", err)
+	}
+	h.GetTopics.Errors = eventPayload.StateTopic
+	return nil
+}
+
+// addExternalChangeEvent déclare l'entité event signalant les modifications faites hors de HA (application Voltalis)
+func (h *Heater) addExternalChangeEvent(payload *ClimateConfigPayload) error {
+	eventPayload := getPayloadExternalChangeEvent(payload.Device)
+	if err := h.PublishConfig(eventPayload); err != nil {
+		return fmt.Errorf("failed to publish heater external change event config: %w", err)
+	}
+	h.GetTopics.ExternalChange = eventPayload.StateTopic
 	return nil
 }
 
@@ -125,13 +260,16 @@ func (h *Heater) addClimate(id int64, name string) (*ClimateConfigPayload, error
 		UniqueID:              fmt.Sprintf("voltalis_heater_%d", id),
 		Name:                  "Temperature",
 		PresetModes: []HeaterPresetMode{HeaterPresetModeHorsGel,
-			HeaterPresetModeEco, HeaterPresetModeConfort},
-		MinTemp:  15,
-		MaxTemp:  25,
-		TempStep: 0.5,
+			HeaterPresetModeEco, HeaterPresetModeConfort, HeaterPresetModeBoost},
+		MinTemp:  h.limits.Min,
+		MaxTemp:  h.limits.Max,
+		TempStep: h.limits.Step,
 		Modes:    []HeaterMode{HeaterModeOff, HeaterModeAuto, HeaterModeHeat},
 		Device:   buildDeviceInfo(id, name),
 	}
+	if h.JSONState {
+		payload.JsonAttributesTopic = NewHeaterTopic[GetTopic](id, "attributes")
+	}
 	if err := h.PublishConfig(payload); err != nil {
 		return nil, fmt.Errorf("failed to publish heater config: %w", err)
 	}
@@ -143,6 +281,7 @@ func (h *Heater) addClimate(id int64, name string) (*ClimateConfigPayload, error
 	h.SetTopics.PresetMode = payload.PresetModeCommandTopic
 	h.GetTopics.PresetMode = payload.PresetModeStateTopic
 	h.GetTopics.CurrentTemperature = payload.CurrentTemperatureTopic
+	h.GetTopics.Attributes = payload.JsonAttributesTopic
 	return payload, nil
 }
 
@@ -156,10 +295,22 @@ func buildDeviceInfo(id int64, name string) DeviceInfo {
 	}
 }
 
+// manualTemperature retourne la consigne à appliquer au passage en mode manuel :
+// la dernière consigne mémorisée, sinon la consigne par défaut du radiateur, ramenée dans sa plage
+func (h *Heater) manualTemperature() float64 {
+	if last := h.StateManager.GetCurrentState().HeaterState[h.id].LastTemperature; last > 0 {
+		return h.limits.Normalize(last)
+	}
+	if h.defaultTemperature > 0 {
+		return h.limits.Normalize(h.defaultTemperature)
+	}
+	return h.limits.Normalize(DEFAULT_MANUAL_TEMPERATURE)
+}
+
 func (h *Heater) recomputeState(data string) {
 	slog.Info("Target preset mode received", "value", data)
 	targetHeaterMode := HeaterModeAuto
-	targetTemperature := TEMPERATURE_NONE
+	var targetTemperature any = TEMPERATURE_NONE
 	targetAction := HeaterActionIdle
 
 	switch HeaterPresetMode(data) {
@@ -173,21 +324,23 @@ func (h *Heater) recomputeState(data string) {
 			targetHeaterMode = HeaterModeOff
 		} else {
 			targetAction = HeaterActionHeating
-			targetTemperature = "18"
+			targetTemperature = h.manualTemperature()
 			targetHeaterMode = HeaterModeHeat
 		}
 	case HeaterPresetModeHorsGel:
 		targetAction = HeaterActionIdle
 	case HeaterPresetModeEco:
 		targetAction = HeaterActionCooling
-	case HeaterPresetModeConfort:
+	case HeaterPresetModeConfort, HeaterPresetModeBoost:
 		targetAction = HeaterActionHeating
 	default:
 		slog.Warn("Unknown preset mode received", "value", data)
 	}
-	h.PublishState(h.GetTopics.Action, targetAction)
-	h.PublishState(h.GetTopics.Mode, targetHeaterMode)
-	h.PublishState(h.GetTopics.Temperature, targetTemperature)
+	h.PublishStates(map[GetTopic]any{
+		h.GetTopics.Action:      targetAction,
+		h.GetTopics.Mode:        targetHeaterMode,
+		h.GetTopics.Temperature: targetTemperature,
+	})
 }
 
 type HeaterSetTopics struct {
@@ -195,6 +348,9 @@ type HeaterSetTopics struct {
 	PresetMode     SetTopic
 	Temperature    SetTopic
 	SingleDuration SetTopic
+	CustomDuration SetTopic
+	CustomEndDate  SetTopic
+	ResumeProgram  SetTopic
 }
 type HeaterGetTopics struct {
 	Action             GetTopic
@@ -203,12 +359,34 @@ type HeaterGetTopics struct {
 	Temperature        GetTopic
 	CurrentTemperature GetTopic
 	SingleDuration     GetTopic
+	Attributes         GetTopic
+	BoostRemaining     GetTopic
+	EndDate            GetTopic
+	Remaining          GetTopic
+	Errors             GetTopic
+	ExternalChange     GetTopic
+	CustomDuration     GetTopic
+	CustomEndDate      GetTopic
 }
 
 type Heater struct {
 	*Client
-	SetTopics HeaterSetTopics
-	GetTopics HeaterGetTopics
+	id                 int64
+	defaultTemperature float64
+	limits             TemperatureLimits
+	SetTopics          HeaterSetTopics
+	GetTopics          HeaterGetTopics
+	discovery          *deviceDiscovery
+}
+
+// listen écoute un topic de commande du radiateur ; les commandes rejetées sont signalées sur son entité "Erreurs"
+func (h *Heater) listen(topic SetTopic, validate Validator, preHook func(data string), publishState func(currentState *state.ResourceState, data string)) {
+	h.listenState(topic, h.id, validate, h.GetTopics.Errors, preHook, publishState)
+}
+
+// PublishConfig publie la configuration d'une entité du radiateur, directement ou via le device selon le mode de découverte
+func (h *Heater) PublishConfig(payload payload) error {
+	return h.discovery.add(payload)
 }
 
 func NewHeaterTopic[T Topic](id int64, suffix string) T {
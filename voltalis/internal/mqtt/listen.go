@@ -1,8 +1,10 @@
 package mqtt
 
 import (
+	"errors"
 	"log/slog"
 	"strings"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/francois76/voltalis-integration/voltalis/internal/state"
@@ -10,20 +12,53 @@ import (
 
 type SetTopic string
 
-func (c *Client) ListenState(topic SetTopic, publishState func(currentState *state.ResourceState, data string)) {
-	c.ListenStateWithPreHook(topic, nil, publishState)
+// ErrReadOnly est renvoyée pour toute commande reçue alors que l'add-on est en lecture seule
+var ErrReadOnly = errors.New("add-on en lecture seule : commande ignorée")
+
+// Validator contrôle une commande reçue de HA avant toute modification de l'état.
+// Il retourne la valeur normalisée à appliquer, ou une erreur si la commande doit être rejetée
+type Validator func(data string) (string, error)
+
+// ListenStateWithValidation écoute un topic de commande en validant chaque message avant de l'appliquer (validate est obligatoire).
+// Une commande rejetée ne modifie pas l'état : la dernière valeur publiée est renvoyée à HA pour annuler l'affichage optimiste,
+// et un événement command_rejected est émis sur errorTopic s'il est renseigné
+func (c *Client) ListenStateWithValidation(topic SetTopic, validate Validator, errorTopic GetTopic, preHook func(data string), publishState func(currentState *state.ResourceState, data string)) {
+	c.listenState(topic, 0, validate, errorTopic, preHook, publishState)
 }
 
-func (c *Client) ListenStateWithPreHook(topic SetTopic, preHook func(data string), publishState func(currentState *state.ResourceState, data string)) {
+// listenState enregistre le handler d'un topic de commande. heaterID identifie le radiateur concerné (0 pour le contrôleur)
+func (c *Client) listenState(topic SetTopic, heaterID int64, validate Validator, errorTopic GetTopic, preHook func(data string), publishState func(currentState *state.ResourceState, data string)) {
 	if topic == "" {
 		panic("tentative d'écouter un topic vide, verifier que les composant ayant généré ce topic est bien instancié")
 	}
+	if validate == nil {
+		panic("tentative d'écouter le topic " + string(topic) + " sans validation")
+	}
 
 	// Créer le handler
 	handler := func(client mqtt.Client, msg mqtt.Message) {
 		data := string(msg.Payload())
 		childlog := slog.With("topic", msg.Topic(), "data", data)
 		childlog.Debug("MQTT message received")
+		relatedGetTopic := GetTopic(strings.Replace(msg.Topic(), "/set", "/get", 1))
+
+		if c.ReadOnly {
+			childlog.Warn("Commande rejetée", "error", ErrReadOnly)
+			c.republishState(relatedGetTopic)
+			c.rejectCommand(errorTopic, topic, data, ErrReadOnly)
+			return
+		}
+		normalized, err := validate(data)
+		if err != nil {
+			childlog.Warn("Commande rejetée", "error", err)
+			c.republishState(relatedGetTopic)
+			c.rejectCommand(errorTopic, topic, data, err)
+			return
+		}
+		if normalized != data {
+			childlog.Debug("Commande normalisée", "value", normalized)
+		}
+		data = normalized
 
 		// MAJ état global
 		c.stateMutex.Lock()
@@ -35,9 +70,8 @@ func (c *Client) ListenStateWithPreHook(topic SetTopic, preHook func(data string
 		}
 		currentState := c.StateManager.GetCurrentState()
 		publishState(&currentState, data)
-		c.StateManager.UpdateState(currentState)
-		relatedGetTopic := strings.Replace(msg.Topic(), "/set", "/get", 1)
-		c.PublishState(GetTopic(relatedGetTopic), data)
+		c.StateManager.UpdateStateFromCommand(currentState, Command{Topic: topic, HeaterID: heaterID, Payload: data, At: time.Now()})
+		c.PublishState(relatedGetTopic, data)
 	}
 
 	// Enregistrer la subscription pour le réabonnement après reconnexion
@@ -46,3 +80,33 @@ func (c *Client) ListenStateWithPreHook(topic SetTopic, preHook func(data string
 	// S'abonner au topic
 	go c.Client.Subscribe(string(topic), 0, handler)
 }
+
+// ListenExternal s'abonne à un topic qui n'appartient pas à l'intégration (capteur tiers par exemple).
+// Le message est transmis tel quel au handler, sans impact sur l'état ni republication
+func (c *Client) ListenExternal(topic string, handle func(data string)) {
+	if topic == "" {
+		panic("tentative d'écouter un topic vide")
+	}
+
+	handler := func(client mqtt.Client, msg mqtt.Message) {
+		data := string(msg.Payload())
+		slog.Debug("MQTT external message received", "topic", msg.Topic(), "data", data)
+		handle(data)
+	}
+
+	c.registerSubscription(topic, handler)
+	go c.Client.Subscribe(topic, 0, handler)
+}
+
+// ListenButton écoute le topic d'un bouton HA. L'appui ne modifie pas l'état et est transmis tel quel à press,
+// sauf en lecture seule où il est rejeté avec un événement command_rejected sur errorTopic
+func (c *Client) ListenButton(topic SetTopic, errorTopic GetTopic, press func()) {
+	c.ListenExternal(string(topic), func(data string) {
+		if c.ReadOnly {
+			slog.Warn("Commande rejetée", "topic", topic, "error", ErrReadOnly)
+			c.rejectCommand(errorTopic, topic, data, ErrReadOnly)
+			return
+		}
+		press()
+	})
+}
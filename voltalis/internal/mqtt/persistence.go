@@ -0,0 +1,67 @@
+package mqtt
+
+import (
+	"log/slog"
+	"maps"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+	"github.com/francois76/voltalis-integration/voltalis/internal/store"
+)
+
+const (
+	persistedStateName = "state"
+	// stateSchemaVersion est à incrémenter à chaque changement incompatible de persistedState
+	stateSchemaVersion = 1
+)
+
+// persistedState est l'état sauvegardé sur disque : état global, dernières valeurs envoyées par HA sur chaque topic
+// et dernières demandes HA de chaque radiateur (arbitrage des changements externes)
+type persistedState struct {
+	State   state.ResourceState `json:"state"`
+	Topics  map[SetTopic]string `json:"topics"`
+	Intents map[int64]Intent    `json:"intents,omitempty"`
+}
+
+// EnablePersistence recharge le dernier état sauvegardé puis le sauvegarde à chaque changement.
+// Doit être appelé avant la déclaration des radiateurs et du contrôleur. Sans store, ne fait rien
+func (c *Client) EnablePersistence(st *store.Store) {
+	if st == nil {
+		return
+	}
+	var saved persistedState
+	found, err := st.LoadVersioned(persistedStateName, stateSchemaVersion, &saved)
+	if err != nil {
+		slog.Error("failed to load persisted state, starting from scratch", "error", err)
+	} else if found {
+		if saved.State.HeaterState == nil {
+			saved.State.HeaterState = make(map[int64]state.HeaterState)
+		}
+		c.StateManager.UpdateStateWithoutNotification(saved.State)
+		c.stateMutex.Lock()
+		maps.Copy(c.stateTopicMap, saved.Topics)
+		c.stateMutex.Unlock()
+		c.StateManager.mu.Lock()
+		maps.Copy(c.StateManager.intents, saved.Intents)
+		c.StateManager.mu.Unlock()
+		slog.Info("État précédent rechargé", "heaters", len(saved.State.HeaterState))
+	}
+
+	c.StateManager.mu.Lock()
+	c.StateManager.changed = make(chan struct{}, 1)
+	changed := c.StateManager.changed
+	c.StateManager.mu.Unlock()
+	go func() {
+		for range changed {
+			c.stateMutex.Lock()
+			topics := maps.Clone(c.stateTopicMap)
+			c.stateMutex.Unlock()
+			c.StateManager.mu.RLock()
+			intents := maps.Clone(c.StateManager.intents)
+			c.StateManager.mu.RUnlock()
+			doc := persistedState{State: c.StateManager.GetCurrentState(), Topics: topics, Intents: intents}
+			if err := st.SaveVersioned(persistedStateName, stateSchemaVersion, doc); err != nil {
+				slog.Error("failed to save state", "error", err)
+			}
+		}
+	}()
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
 	"reflect"
 )
 
@@ -14,15 +15,33 @@ func (c *Client) PublishConfig(payload payload) error {
 	return c.publish(fmt.Sprintf("homeassistant/%s/%s/config", payload.getComponent(), payload.getIdentifier()), true, payload)
 }
 
+// removeConfig supprime une entité de Home Assistant en vidant sa configuration retenue
+func (c *Client) removeConfig(component component, identifier string) error {
+	return c.publish(fmt.Sprintf("homeassistant/%s/%s/config", component, identifier), true, "")
+}
+
 // PublishState publie une mise à jour d'état (retained=false)
-// Si une mise a jour d'état tombe en erreur, on ne fait pas tomber le processus complet
+// Si le topic est rattaché à un document JSON, c'est le document complet qui est republié
 func (c *Client) PublishState(topic GetTopic, payload any) {
+	c.PublishStates(map[GetTopic]any{topic: payload})
+}
+
+// publishState publie une valeur brute sur un topic d'état
+// Si une mise a jour d'état tombe en erreur, on ne fait pas tomber le processus complet
+func (c *Client) publishState(topic GetTopic, payload any) {
 	err := c.publish(string(topic), false, payload)
 	if err != nil {
 		slog.Error("Failed to publish state", "topic", topic, "error", err)
 	}
 }
 
+// PublishEvent déclenche une entité event : le payload JSON porte le type d'événement et ses attributs
+func (c *Client) PublishEvent(topic GetTopic, eventType string, attributes map[string]any) {
+	payload := map[string]any{"event_type": eventType}
+	maps.Copy(payload, attributes)
+	c.publishState(topic, payload)
+}
+
 // PublishState publie une mise à jour de valeur
 // Si une mise a jour d'état tombe en erreur, on ne fait pas tomber le processus complet
 func (c *Client) PublishCommand(topic SetTopic, payload any) {
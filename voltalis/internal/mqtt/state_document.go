@@ -0,0 +1,103 @@
+package mqtt
+
+import (
+	"fmt"
+	"maps"
+)
+
+// stateDocument agrège plusieurs valeurs d'état dans un unique document JSON publié sur un seul topic.
+// Home Assistant relit chaque valeur via un value_template, ce qui évite les états intermédiaires incohérents
+type stateDocument struct {
+	topic  GetTopic
+	values map[string]any
+}
+
+// documentField relie un topic d'état unitaire à une clé d'un document
+type documentField struct {
+	document *stateDocument
+	key      string
+}
+
+// bindStateDocument redirige les topics d'état unitaires vers un document JSON (no-op si JSONState est désactivé)
+func (c *Client) bindStateDocument(topic GetTopic, fields map[GetTopic]string) {
+	if !c.JSONState {
+		return
+	}
+	c.documentsMutex.Lock()
+	defer c.documentsMutex.Unlock()
+	document := &stateDocument{topic: topic, values: make(map[string]any)}
+	for fieldTopic, key := range fields {
+		c.documentFields[fieldTopic] = documentField{document: document, key: key}
+	}
+}
+
+// documentTopic retourne le topic et le template à utiliser dans la découverte pour un topic d'état unitaire
+func (c *Client) documentTopic(topic GetTopic) (GetTopic, string) {
+	c.documentsMutex.Lock()
+	defer c.documentsMutex.Unlock()
+	field, ok := c.documentFields[topic]
+	if !ok {
+		return topic, ""
+	}
+	return field.document.topic, fmt.Sprintf("{{ value_json.%s }}", field.key)
+}
+
+// PublishStates publie plusieurs mises à jour d'état d'un coup.
+// Les valeurs rattachées à un même document JSON donnent lieu à une seule publication
+func (c *Client) PublishStates(values map[GetTopic]any) {
+	documents := make(map[GetTopic]map[string]any)
+	direct := make(map[GetTopic]any)
+
+	c.documentsMutex.Lock()
+	for topic, value := range values {
+		c.published[topic] = value
+		field, ok := c.documentFields[topic]
+		if !ok {
+			direct[topic] = value
+			continue
+		}
+		field.document.values[field.key] = value
+		documents[field.document.topic] = maps.Clone(field.document.values)
+	}
+	c.documentsMutex.Unlock()
+
+	for topic, value := range direct {
+		c.publishState(topic, value)
+	}
+	for topic, document := range documents {
+		c.publishState(topic, document)
+	}
+}
+
+// withStateDocument retourne une copie du payload dont les topics d'état pointent vers leur document JSON
+func (p *ClimateConfigPayload) withStateDocument(c *Client) payload {
+	documented := *p
+	documented.ModeStateTopic, documented.ModeStateTemplate = c.documentTopic(p.ModeStateTopic)
+	documented.PresetModeStateTopic, documented.PresetModeValueTemplate = c.documentTopic(p.PresetModeStateTopic)
+	documented.TemperatureStateTopic, documented.TemperatureStateTemplate = c.documentTopic(p.TemperatureStateTopic)
+	documented.CurrentTemperatureTopic, documented.CurrentTemperatureTemplate = c.documentTopic(p.CurrentTemperatureTopic)
+	documented.ActionTopic, documented.ActionTemplate = c.documentTopic(p.ActionTopic)
+	return &documented
+}
+
+func (p *SelectConfigPayload[T]) withStateDocument(c *Client) payload {
+	documented := *p
+	documented.StateTopic, documented.ValueTemplate = c.documentTopic(p.StateTopic)
+	return &documented
+}
+
+func (p *SensorConfigPayload) withStateDocument(c *Client) payload {
+	documented := *p
+	documented.StateTopic, documented.ValueTemplate = c.documentTopic(p.StateTopic)
+	return &documented
+}
+
+// republishState renvoie la dernière valeur publiée sur un topic d'état (rien si le topic n'a jamais été publié)
+func (c *Client) republishState(topic GetTopic) {
+	c.documentsMutex.Lock()
+	value, ok := c.published[topic]
+	c.documentsMutex.Unlock()
+	if ok {
+		c.PublishState(topic, value)
+	}
+}
@@ -7,74 +7,38 @@ import (
 	"log"
 	"log/slog"
 	"maps"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/francois76/voltalis-integration/voltalis/internal/state"
 )
 
-func compareResourceState(previous, current state.ResourceState) map[string]interface{} {
-	changes := make(map[string]interface{})
-
-	// Comparaison du ControllerState
-	if controllerChanges := previous.ControllerState.Compare(current.ControllerState); len(controllerChanges) > 0 {
-		changes["ControllerState"] = controllerChanges
-	}
-
-	// Comparaison des HeaterState avec la fonction générique
-	if heaterChanges := compareMaps(previous.HeaterState, current.HeaterState); len(heaterChanges) > 0 {
-		changes["HeaterState"] = heaterChanges
-	}
-
-	return changes
+// StateChange représente un changement d'état avec les valeurs modifiées
+type StateChange struct {
+	CurrentState state.ResourceState `json:"current_state"`
+	Changes      state.Changes       `json:"changes"`
+	PreviousHash string              `json:"previous_hash"`
+	CurrentHash  string              `json:"current_hash"`
+	// Commands liste les commandes HA à l'origine du changement, dans leur ordre de réception
+	Commands []Command `json:"commands,omitempty"`
 }
 
-// Fonction générique pour comparer des maps
-func compareMaps[K comparable, V state.Comparable](previous, current map[K]V) map[string]interface{} {
-	changes := make(map[string]interface{})
-
-	// Éléments supprimés
-	var removed []K
-	for key := range previous {
-		if _, exists := current[key]; !exists {
-			removed = append(removed, key)
-		}
-	}
-	if len(removed) > 0 {
-		changes["removed"] = removed
-	}
-
-	// Éléments ajoutés et modifiés
-	added := make(map[K]V)
-	modified := make(map[K]map[string]interface{})
-
-	for key, currentValue := range current {
-		if previousValue, exists := previous[key]; exists {
-			// Élément existant - vérifier les changements
-			if itemChanges := previousValue.Compare(currentValue); len(itemChanges) > 0 {
-				modified[key] = itemChanges
-			}
-		} else {
-			// Nouvel élément
-			added[key] = currentValue
-		}
-	}
-
-	if len(added) > 0 {
-		changes["added"] = added
-	}
-	if len(modified) > 0 {
-		changes["modified"] = modified
-	}
-
-	return changes
+// Command est une commande reçue de HA sur un topic /set
+type Command struct {
+	Topic SetTopic `json:"topic"`
+	// HeaterID est le radiateur visé par la commande (0 pour le contrôleur)
+	HeaterID int64     `json:"heater_id,omitempty"`
+	Payload  string    `json:"payload"`
+	At       time.Time `json:"at"`
 }
 
-// StateChange représente un changement d'état avec les valeurs modifiées
-type StateChange struct {
-	CurrentState  state.ResourceState `json:"current_state"`
-	ChangedFields map[string]any      `json:"changed_fields"`
-	PreviousHash  string              `json:"previous_hash"`
-	CurrentHash   string              `json:"current_hash"`
+// Intent est le dernier état d'un radiateur demandé par HA, avec les champs fixés par l'utilisateur
+// depuis son dernier choix de mode ou de preset
+type Intent struct {
+	State  state.HeaterState `json:"state"`
+	Fields state.Fields      `json:"fields"`
+	At     time.Time         `json:"at"`
 }
 
 // StateManager gère les états et détecte les changements
@@ -83,14 +47,30 @@ type StateManager struct {
 	currentState *state.ResourceState
 	previousHash string
 	stateChannel chan StateChange
-	subscribers  []chan StateChange
+	subscribers  []*subscription
+	// changed signale les changements d'état à sauvegarder (nil si la persistance est désactivée)
+	changed chan struct{}
+	// intents mémorise l'état souhaité par HA pour chaque radiateur commandé
+	intents map[int64]Intent
+}
+
+// subscription délivre les changements à un abonné sans jamais en perdre :
+// tant que l'abonné n'a pas consommé le changement en attente, les suivants y sont fusionnés
+// (état courant le plus récent, union des champs modifiés)
+type subscription struct {
+	mu        sync.Mutex
+	pending   *StateChange
+	coalesced int
+	signal    chan struct{}
+	out       chan StateChange
 }
 
 // NewStateManager crée une nouvelle instance du gestionnaire d'état
 func NewStateManager() *StateManager {
 	return &StateManager{
 		stateChannel: make(chan StateChange, 100), // Buffer pour éviter les blocages
-		subscribers:  make([]chan StateChange, 0),
+		subscribers:  make([]*subscription, 0),
+		intents:      make(map[int64]Intent),
 	}
 }
 
@@ -99,9 +79,61 @@ func (sm *StateManager) Subscribe() <-chan StateChange {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	subscriber := make(chan StateChange, 10)
-	sm.subscribers = append(sm.subscribers, subscriber)
-	return subscriber
+	sub := &subscription{
+		signal: make(chan struct{}, 1),
+		out:    make(chan StateChange),
+	}
+	sm.subscribers = append(sm.subscribers, sub)
+	go sub.deliver()
+	return sub.out
+}
+
+// push ajoute un changement à délivrer, fusionné avec celui en attente s'il n'a pas encore été consommé
+func (sub *subscription) push(change StateChange) {
+	sub.mu.Lock()
+	if sub.pending == nil {
+		sub.pending = &change
+	} else {
+		merged := mergeStateChanges(*sub.pending, change)
+		sub.pending = &merged
+		sub.coalesced++
+	}
+	sub.mu.Unlock()
+
+	select {
+	case sub.signal <- struct{}{}:
+	default:
+		// Une livraison est déjà signalée, elle emportera le changement fusionné
+	}
+}
+
+// deliver transmet à l'abonné le changement en attente, en bloquant jusqu'à ce qu'il soit consommé
+func (sub *subscription) deliver() {
+	for range sub.signal {
+		sub.mu.Lock()
+		change, coalesced := sub.pending, sub.coalesced
+		sub.pending, sub.coalesced = nil, 0
+		sub.mu.Unlock()
+		if change == nil {
+			continue
+		}
+		if coalesced > 0 {
+			slog.Debug("Changements fusionnés pendant que l'abonné était occupé", "count", coalesced+1)
+		}
+		sub.out <- *change
+	}
+}
+
+// mergeStateChanges fusionne deux changements successifs : l'état courant est celui du plus récent
+// et les champs modifiés sont l'union des deux
+func mergeStateChanges(older, newer StateChange) StateChange {
+	return StateChange{
+		CurrentState: newer.CurrentState,
+		Changes:      older.Changes.Merge(newer.Changes),
+		PreviousHash: older.PreviousHash,
+		CurrentHash:  newer.CurrentHash,
+		Commands:     append(slices.Clip(older.Commands), newer.Commands...),
+	}
 }
 
 // computeStateHash calcule un hash de l'état pour la déduplication
@@ -113,6 +145,15 @@ func (sm *StateManager) computeStateHash(state state.ResourceState) string {
 
 // UpdateState met à jour l'état et notifie les changements si nécessaire
 func (sm *StateManager) UpdateState(newState state.ResourceState) {
+	sm.update(newState, nil)
+}
+
+// UpdateStateFromCommand met à jour l'état suite à une commande HA, transmise avec le changement notifié
+func (sm *StateManager) UpdateStateFromCommand(newState state.ResourceState, command Command) {
+	sm.update(newState, []Command{command})
+}
+
+func (sm *StateManager) update(newState state.ResourceState, commands []Command) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
@@ -124,43 +165,75 @@ func (sm *StateManager) UpdateState(newState state.ResourceState) {
 		return
 	}
 
-	var changedFields map[string]any
+	var changes state.Changes
 
 	// Si on a un état précédent, on calcule les différences
 	if sm.currentState != nil {
-		changedFields = compareResourceState(*sm.currentState, newState)
+		changes = state.Diff(*sm.currentState, newState)
 	} else {
-		// Premier état : tous les champs sont "nouveaux"
-		changedFields = map[string]any{
-			"initial_state": true,
-		}
+		// Premier état : pas de comparaison possible
+		changes = state.Changes{Initial: true}
 	}
 
 	// Création du StateChange
 	stateChange := StateChange{
-		CurrentState:  newState,
-		ChangedFields: changedFields,
-		PreviousHash:  sm.previousHash,
-		CurrentHash:   currentHash,
+		CurrentState: newState,
+		Changes:      changes,
+		PreviousHash: sm.previousHash,
+		CurrentHash:  currentHash,
+		Commands:     commands,
 	}
 
 	// Mise à jour de l'état interne
 	sm.currentState = &newState
 	sm.previousHash = currentHash
+	sm.recordIntents(changes, commands)
+	sm.signalChange()
 
 	// Notification des abonnés
 	sm.notifySubscribers(stateChange)
 }
 
-// notifySubscribers envoie le changement à tous les abonnés
+// recordIntents mémorise l'état demandé par les commandes HA de radiateurs.
+// Les champs fixés s'accumulent (consigne, durée...) jusqu'au prochain choix de mode ou de preset
+func (sm *StateManager) recordIntents(changes state.Changes, commands []Command) {
+	for _, command := range commands {
+		change, ok := changes.Heaters[command.HeaterID]
+		if command.HeaterID == 0 || !ok {
+			continue
+		}
+		fields := change.Fields
+		if !fields.Has(state.FieldMode) && !fields.Has(state.FieldPresetMode) {
+			fields = sm.intents[command.HeaterID].Fields.Union(fields)
+		}
+		sm.intents[command.HeaterID] = Intent{State: change.New, Fields: fields, At: command.At}
+	}
+}
+
+// Intent retourne le dernier état demandé par HA pour un radiateur
+func (sm *StateManager) Intent(id int64) (Intent, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	intent, ok := sm.intents[id]
+	return intent, ok
+}
+
+// ClearIntent oublie la demande HA d'un radiateur, remplacée par une action de l'add-on
+// (retour à la programmation, fin d'un forçage) ou par un changement externe adopté
+func (sm *StateManager) ClearIntent(id int64) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if _, ok := sm.intents[id]; !ok {
+		return
+	}
+	delete(sm.intents, id)
+	sm.signalChange()
+}
+
+// notifySubscribers transmet le changement à tous les abonnés, sans bloquer ni perdre de changement
 func (sm *StateManager) notifySubscribers(change StateChange) {
 	for _, subscriber := range sm.subscribers {
-		select {
-		case subscriber <- change:
-			// Envoi réussi
-		default:
-			slog.Info("Abonné occupé, changement ignoré")
-		}
+		subscriber.push(change)
 	}
 }
 
@@ -184,7 +257,53 @@ func (sm *StateManager) UpdateStateWithoutNotification(newState state.ResourceSt
 	defer sm.mu.Unlock()
 
 	currentHash := sm.computeStateHash(newState)
+	if currentHash != sm.previousHash {
+		sm.signalChange()
+	}
 	sm.currentState = &newState
 	sm.previousHash = currentHash
 	slog.Debug("État mis à jour silencieusement (sync Voltalis)")
 }
+
+// UpdateHeatersWithoutNotification met à jour les seuls radiateurs indiqués, sans notification.
+// update reçoit l'état courant de chaque radiateur et retourne son nouvel état ; la lecture et l'écriture
+// se font sous le même verrou, les commandes HA reçues entre-temps sur les autres entités sont donc conservées
+func (sm *StateManager) UpdateHeatersWithoutNotification(ids []int64, update func(id int64, previous state.HeaterState) state.HeaterState) map[int64]state.HeaterState {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var newState state.ResourceState
+	if sm.currentState != nil {
+		newState = *sm.currentState
+	}
+	// Copie de la map : les changements déjà notifiés partagent celle de l'état courant
+	newState.HeaterState = maps.Clone(newState.HeaterState)
+	if newState.HeaterState == nil {
+		newState.HeaterState = make(map[int64]state.HeaterState)
+	}
+	updated := make(map[int64]state.HeaterState, len(ids))
+	for _, id := range ids {
+		newState.HeaterState[id] = update(id, newState.HeaterState[id])
+		updated[id] = newState.HeaterState[id]
+	}
+
+	currentHash := sm.computeStateHash(newState)
+	if currentHash != sm.previousHash {
+		sm.signalChange()
+	}
+	sm.currentState = &newState
+	sm.previousHash = currentHash
+	slog.Debug("Radiateurs mis à jour silencieusement (relecture Voltalis)", "heaterIDs", ids)
+	return updated
+}
+
+// signalChange demande une sauvegarde de l'état, sans bloquer : une sauvegarde déjà demandée emportera le dernier état
+func (sm *StateManager) signalChange() {
+	if sm.changed == nil {
+		return
+	}
+	select {
+	case sm.changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,104 @@
+package mqtt
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+)
+
+// Un abonné bloqué pendant une rafale de mises à jour reçoit, une fois débloqué,
+// l'état final et l'union de tous les champs modifiés : aucun changement n'est perdu
+func TestSlowSubscriberLosesNoChange(t *testing.T) {
+	sm := NewStateManager()
+	changes := sm.Subscribe()
+
+	initial := state.ResourceState{
+		ControllerState: state.ControllerState{Program: "Semaine"},
+		HeaterState: map[int64]state.HeaterState{
+			1: {Mode: state.HeaterModeAuto, PresetMode: state.HeaterPresetModeConfort},
+			2: {Mode: state.HeaterModeAuto, PresetMode: state.HeaterPresetModeConfort},
+		},
+	}
+	sm.UpdateState(initial)
+	if change := receive(t, changes); !change.Changes.Initial {
+		t.Fatalf("le premier changement doit être l'état initial, reçu %+v", change.Changes)
+	}
+
+	// L'abonné ne lit plus rien pendant la rafale
+	current := initial
+	update := func(apply func(s *state.ResourceState)) {
+		current.HeaterState = maps.Clone(current.HeaterState)
+		apply(&current)
+		sm.UpdateState(current)
+	}
+	update(func(s *state.ResourceState) {
+		h := s.HeaterState[1]
+		h.Mode = state.HeaterModeHeat
+		s.HeaterState[1] = h
+	})
+	for i := range 50 {
+		update(func(s *state.ResourceState) {
+			h := s.HeaterState[1]
+			h.Temperature = 15 + float64(i)/10
+			s.HeaterState[1] = h
+		})
+	}
+	update(func(s *state.ResourceState) {
+		h := s.HeaterState[2]
+		h.PresetMode = state.HeaterPresetModeEco
+		s.HeaterState[2] = h
+	})
+	update(func(s *state.ResourceState) { s.ControllerState.Program = "Vacances" })
+	update(func(s *state.ResourceState) {
+		h := s.HeaterState[1]
+		h.Duration = "Pendant 2 heures"
+		s.HeaterState[1] = h
+	})
+
+	// Le premier changement de la rafale a pu partir avant que l'abonné ne bloque : on fusionne ce qui arrive
+	merged := receive(t, changes)
+	for merged.CurrentHash != sm.previousHash {
+		merged = mergeStateChanges(merged, receive(t, changes))
+	}
+
+	if !merged.Changes.Heaters[1].Fields.Only(state.FieldMode, state.FieldTemperature, state.FieldDuration) {
+		t.Errorf("champs du radiateur 1 = %v", merged.Changes.Heaters[1].Fields)
+	}
+	if merged.Changes.Heaters[1].Old != initial.HeaterState[1] {
+		t.Errorf("ancien état du radiateur 1 = %+v, attendu %+v", merged.Changes.Heaters[1].Old, initial.HeaterState[1])
+	}
+	if merged.Changes.Heaters[1].New != current.HeaterState[1] {
+		t.Errorf("nouvel état du radiateur 1 = %+v, attendu %+v", merged.Changes.Heaters[1].New, current.HeaterState[1])
+	}
+	if !merged.Changes.Heaters[2].Fields.Only(state.FieldPresetMode) {
+		t.Errorf("champs du radiateur 2 = %v", merged.Changes.Heaters[2].Fields)
+	}
+	if merged.Changes.Controller == nil || !merged.Changes.Controller.Fields.Only(state.FieldProgram) {
+		t.Errorf("changement du contrôleur = %+v", merged.Changes.Controller)
+	}
+	if merged.CurrentHash != sm.computeStateHash(current) {
+		t.Errorf("le hash courant ne correspond pas à l'état final")
+	}
+	if merged.CurrentState.HeaterState[1].Temperature != current.HeaterState[1].Temperature {
+		t.Errorf("consigne finale = %v, attendu %v", merged.CurrentState.HeaterState[1].Temperature, current.HeaterState[1].Temperature)
+	}
+
+	select {
+	case extra := <-changes:
+		t.Errorf("changement inattendu après la rafale: %+v", extra.Changes)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func receive(t *testing.T, changes <-chan StateChange) StateChange {
+	t.Helper()
+	select {
+	case change := <-changes:
+		return change
+	case <-time.After(time.Second):
+		t.Fatal("aucun changement reçu")
+		return StateChange{}
+	}
+}
@@ -5,6 +5,11 @@ type payload interface {
 	getComponent() component
 }
 
+// documentedPayload est implémenté par les payloads dont les topics d'état peuvent être redirigés vers un document JSON
+type documentedPayload interface {
+	withStateDocument(c *Client) payload
+}
+
 type ClimateCommandPayload struct {
 	ModeCommandTopic        SetTopic `json:"mode_command_topic"`
 	PresetModeCommandTopic  SetTopic `json:"preset_mode_command_topic,omitempty"`
@@ -22,16 +27,21 @@ type ClimateStatePayload struct {
 type ClimateConfigPayload struct {
 	ClimateCommandPayload
 	ClimateStatePayload
-	ActionTopic              GetTopic           `json:"action_topic,omitempty"`
-	Name                     string             `json:"name"`
-	UniqueID                 string             `json:"unique_id"`
-	PresetModes              []HeaterPresetMode `json:"preset_modes,omitempty"`
-	MinTemp                  float64            `json:"min_temp"`
-	MaxTemp                  float64            `json:"max_temp"`
-	TempStep                 float64            `json:"temp_step"`
-	Modes                    []HeaterMode       `json:"modes"`
-	Device                   DeviceInfo         `json:"device"`
-	TemperatureStateTemplate string             `json:"temperature_state_template,omitempty"`
+	ActionTopic                GetTopic           `json:"action_topic,omitempty"`
+	Name                       string             `json:"name"`
+	UniqueID                   string             `json:"unique_id"`
+	PresetModes                []HeaterPresetMode `json:"preset_modes,omitempty"`
+	MinTemp                    float64            `json:"min_temp"`
+	MaxTemp                    float64            `json:"max_temp"`
+	TempStep                   float64            `json:"temp_step"`
+	Modes                      []HeaterMode       `json:"modes"`
+	Device                     DeviceInfo         `json:"device"`
+	TemperatureStateTemplate   string             `json:"temperature_state_template,omitempty"`
+	ModeStateTemplate          string             `json:"mode_state_template,omitempty"`
+	PresetModeValueTemplate    string             `json:"preset_mode_value_template,omitempty"`
+	CurrentTemperatureTemplate string             `json:"current_temperature_template,omitempty"`
+	ActionTemplate             string             `json:"action_template,omitempty"`
+	JsonAttributesTopic        GetTopic           `json:"json_attributes_topic,omitempty"`
 }
 
 func (p *ClimateConfigPayload) getIdentifier() string {
@@ -43,12 +53,13 @@ func (p *ClimateConfigPayload) getComponent() component {
 }
 
 type SelectConfigPayload[T ~string | ~int64] struct {
-	Name         string     `json:"name"`
-	UniqueID     string     `json:"unique_id"`
-	CommandTopic SetTopic   `json:"command_topic"`
-	StateTopic   GetTopic   `json:"state_topic"`
-	Options      []T        `json:"options"`
-	Device       DeviceInfo `json:"device"`
+	Name          string     `json:"name"`
+	UniqueID      string     `json:"unique_id"`
+	CommandTopic  SetTopic   `json:"command_topic"`
+	StateTopic    GetTopic   `json:"state_topic"`
+	ValueTemplate string     `json:"value_template,omitempty"`
+	Options       []T        `json:"options"`
+	Device        DeviceInfo `json:"device"`
 }
 
 func (p *SelectConfigPayload[T]) getIdentifier() string {
@@ -60,10 +71,13 @@ func (p *SelectConfigPayload[T]) getComponent() component {
 }
 
 type SensorConfigPayload struct {
-	Name       string     `json:"name"`
-	UniqueID   string     `json:"unique_id"`
-	StateTopic GetTopic   `json:"state_topic"`
-	Device     DeviceInfo `json:"device"`
+	Name              string     `json:"name"`
+	UniqueID          string     `json:"unique_id"`
+	StateTopic        GetTopic   `json:"state_topic"`
+	ValueTemplate     string     `json:"value_template,omitempty"`
+	UnitOfMeasurement string     `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string     `json:"device_class,omitempty"`
+	Device            DeviceInfo `json:"device"`
 }
 
 func (p *SensorConfigPayload) getIdentifier() string {
@@ -89,6 +103,44 @@ func (b *ButtonConfigPayload) getComponent() component {
 	return ComponentButton
 }
 
+type NumberConfigPayload struct {
+	Name              string     `json:"name"`
+	UniqueID          string     `json:"unique_id"`
+	CommandTopic      SetTopic   `json:"command_topic"`
+	StateTopic        GetTopic   `json:"state_topic"`
+	Min               float64    `json:"min"`
+	Max               float64    `json:"max"`
+	Step              float64    `json:"step"`
+	Mode              string     `json:"mode,omitempty"`
+	UnitOfMeasurement string     `json:"unit_of_measurement,omitempty"`
+	Device            DeviceInfo `json:"device"`
+}
+
+func (p *NumberConfigPayload) getIdentifier() string {
+	return p.UniqueID
+}
+
+func (p *NumberConfigPayload) getComponent() component {
+	return ComponentNumber
+}
+
+type TextConfigPayload struct {
+	Name         string     `json:"name"`
+	UniqueID     string     `json:"unique_id"`
+	CommandTopic SetTopic   `json:"command_topic"`
+	StateTopic   GetTopic   `json:"state_topic"`
+	Pattern      string     `json:"pattern,omitempty"`
+	Device       DeviceInfo `json:"device"`
+}
+
+func (p *TextConfigPayload) getIdentifier() string {
+	return p.UniqueID
+}
+
+func (p *TextConfigPayload) getComponent() component {
+	return ComponentText
+}
+
 // DeviceInfo représente les informations du périphérique pour Home Assistant
 type DeviceInfo struct {
 	Identifiers  []string `json:"identifiers"`
@@ -97,3 +149,34 @@ type DeviceInfo struct {
 	Model        string   `json:"model"`
 	SwVersion    string   `json:"sw_version"`
 }
+
+// OriginInfo décrit l'application à l'origine des messages de découverte
+type OriginInfo struct {
+	Name       string `json:"name"`
+	SwVersion  string `json:"sw_version,omitempty"`
+	SupportURL string `json:"support_url,omitempty"`
+}
+
+// DeviceConfigPayload représente la découverte d'un device complet (HA 2024.11+)
+// Chaque composant est indexé par son unique_id et porte sa plateforme
+type DeviceConfigPayload struct {
+	Device     DeviceInfo                `json:"device"`
+	Origin     OriginInfo                `json:"origin"`
+	Components map[string]map[string]any `json:"components"`
+}
+
+type EventConfigPayload struct {
+	Name       string     `json:"name"`
+	UniqueID   string     `json:"unique_id"`
+	StateTopic GetTopic   `json:"state_topic"`
+	EventTypes []string   `json:"event_types"`
+	Device     DeviceInfo `json:"device"`
+}
+
+func (p *EventConfigPayload) getIdentifier() string {
+	return p.UniqueID
+}
+
+func (p *EventConfigPayload) getComponent() component {
+	return ComponentEvent
+}
@@ -0,0 +1,46 @@
+package mqtt
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TemperatureLimits décrit la plage de consigne acceptée par un radiateur et son pas de réglage
+type TemperatureLimits struct {
+	Min  float64
+	Max  float64
+	Step float64
+}
+
+// DEFAULT_TEMPERATURE_LIMITS est la plage utilisée quand ni l'API ni les options ne précisent les bornes d'un radiateur
+var DEFAULT_TEMPERATURE_LIMITS = TemperatureLimits{Min: 15, Max: 25, Step: 0.5}
+
+// Valid indique si les bornes sont exploitables (plage non vide et pas positif)
+func (l TemperatureLimits) Valid() bool {
+	return l.Min > 0 && l.Max > l.Min && l.Step > 0
+}
+
+// Normalize arrondit une consigne au pas du radiateur puis la ramène dans sa plage
+func (l TemperatureLimits) Normalize(value float64) float64 {
+	if !l.Valid() {
+		l = DEFAULT_TEMPERATURE_LIMITS
+	}
+	value = l.Min + math.Round((value-l.Min)/l.Step)*l.Step
+	// Arrondi au centième pour absorber les erreurs de virgule flottante (0.1 + 0.2...)
+	value = math.Round(value*100) / 100
+	return math.Min(l.Max, math.Max(l.Min, value))
+}
+
+// ParseTemperature lit une consigne reçue de HA et la normalise selon les bornes du radiateur
+func (l TemperatureLimits) ParseTemperature(data string) (float64, error) {
+	value, err := strconv.ParseFloat(strings.TrimSpace(data), 64)
+	if err != nil {
+		return 0, fmt.Errorf("consigne invalide %q: %w", data, err)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("consigne invalide %q", data)
+	}
+	return l.Normalize(value), nil
+}
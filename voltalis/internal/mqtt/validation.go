@@ -0,0 +1,71 @@
+package mqtt
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// oneOf accepte uniquement les valeurs d'une liste fermée (modes, presets...)
+func oneOf[T ~string](options ...T) Validator {
+	return func(data string) (string, error) {
+		if !slices.Contains(options, T(data)) {
+			return "", fmt.Errorf("valeur %q inconnue, valeurs acceptées: %v", data, options)
+		}
+		return data, nil
+	}
+}
+
+// validateDuration accepte uniquement les options du select de durée
+func validateDuration(data string) (string, error) {
+	if !IsDurationOption(data) {
+		return "", fmt.Errorf("durée %q inconnue, valeurs acceptées: %v", data, DURATION_OPTIONS)
+	}
+	return data, nil
+}
+
+// validateCustomDuration accepte un nombre de minutes positif
+func validateCustomDuration(data string) (string, error) {
+	if _, err := CustomDurationName(data); err != nil {
+		return "", err
+	}
+	return data, nil
+}
+
+// validateCustomEndDate accepte une date de fin future, lisible dans le fuseau du site
+func validateCustomEndDate(location func() *time.Location) Validator {
+	return func(data string) (string, error) {
+		name, err := CustomEndDateName(data, location())
+		if err != nil {
+			return "", err
+		}
+		if _, err := ParseEndDate(name, time.Now()); err != nil {
+			return "", err
+		}
+		return data, nil
+	}
+}
+
+// validateTemperature accepte une consigne numérique, arrondie au pas et ramenée dans la plage du radiateur
+func validateTemperature(limits TemperatureLimits) Validator {
+	return func(data string) (string, error) {
+		temperature, err := limits.ParseTemperature(data)
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatFloat(temperature, 'f', -1, 64), nil
+	}
+}
+
+// rejectCommand signale dans HA une commande refusée par la validation
+func (c *Client) rejectCommand(errorTopic GetTopic, topic SetTopic, data string, err error) {
+	if errorTopic == "" {
+		return
+	}
+	c.PublishEvent(errorTopic, EventCommandRejected, map[string]any{
+		"topic":   string(topic),
+		"payload": data,
+		"message": err.Error(),
+	})
+}
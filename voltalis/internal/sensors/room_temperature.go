@@ -0,0 +1,169 @@
+package sensors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/config"
+	"github.com/francois76/voltalis-integration/voltalis/internal/homeassistant"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+)
+
+const defaultMaxAge = 30 * time.Minute
+
+// RoomTemperatures relaie les températures de pièce fournies par des capteurs externes
+// (topic MQTT ou entité HA) vers le current_temperature de l'entité climate de chaque radiateur
+type RoomTemperatures struct {
+	mqttClient *mqtt.Client
+	haClient   *homeassistant.Client
+	heaters    []config.HeaterOptions
+
+	mu       sync.RWMutex
+	readings map[int64]reading
+}
+
+type reading struct {
+	value float64
+	at    time.Time
+	stale bool
+}
+
+func NewRoomTemperatures(mqttClient *mqtt.Client, haClient *homeassistant.Client, heaters []config.HeaterOptions) *RoomTemperatures {
+	return &RoomTemperatures{
+		mqttClient: mqttClient,
+		haClient:   haClient,
+		heaters:    heaters,
+		readings:   make(map[int64]reading),
+	}
+}
+
+// Start s'abonne aux capteurs MQTT et lance la boucle de rafraîchissement des entités HA et de détection des mesures périmées
+func (r *RoomTemperatures) Start(ctx context.Context) {
+	for _, heater := range r.heaters {
+		if heater.RoomTemperatureTopic == "" {
+			continue
+		}
+		heater := heater
+		r.mqttClient.ListenExternal(heater.RoomTemperatureTopic, func(data string) {
+			value, err := parseTemperature(data)
+			if err != nil {
+				slog.Warn("Température de pièce invalide", "applianceID", heater.ApplianceID, "topic", heater.RoomTemperatureTopic, "error", err)
+				return
+			}
+			r.record(int64(heater.ApplianceID), toCelsius(value, heater.RoomTemperatureUnit))
+		})
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			r.pollEntities()
+			r.expire()
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Get retourne la dernière température de pièce connue (en °C) si elle n'est pas périmée
+func (r *RoomTemperatures) Get(id int64) (float64, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	current, ok := r.readings[id]
+	if !ok || current.stale {
+		return 0, false
+	}
+	return current.value, true
+}
+
+func (r *RoomTemperatures) record(id int64, value float64) {
+	value = math.Round(value*10) / 10
+	r.mu.Lock()
+	r.readings[id] = reading{value: value, at: time.Now()}
+	r.mu.Unlock()
+	r.mqttClient.PublishState(r.mqttClient.BuildHeaterStateTopic(id).CurrentTemperature, value)
+}
+
+// pollEntities relit l'état des entités HA configurées comme capteur de température
+func (r *RoomTemperatures) pollEntities() {
+	for _, heater := range r.heaters {
+		if heater.RoomTemperatureEntity == "" || heater.RoomTemperatureTopic != "" {
+			continue
+		}
+		entity, err := r.haClient.GetState(heater.RoomTemperatureEntity)
+		if err != nil {
+			slog.Warn("Lecture de l'entité de température impossible", "entity", heater.RoomTemperatureEntity, "error", err)
+			continue
+		}
+		value, err := strconv.ParseFloat(entity.State, 64)
+		if err != nil {
+			slog.Debug("Entité de température sans valeur numérique", "entity", heater.RoomTemperatureEntity, "state", entity.State)
+			continue
+		}
+		unit := heater.RoomTemperatureUnit
+		if entityUnit, ok := entity.Attributes["unit_of_measurement"].(string); ok {
+			unit = entityUnit
+		}
+		r.record(int64(heater.ApplianceID), toCelsius(value, unit))
+	}
+}
+
+// expire marque comme périmées les mesures trop anciennes et efface la température affichée dans HA
+func (r *RoomTemperatures) expire() {
+	for _, heater := range r.heaters {
+		id := int64(heater.ApplianceID)
+		maxAge := defaultMaxAge
+		if heater.RoomTemperatureMaxAge > 0 {
+			maxAge = time.Duration(heater.RoomTemperatureMaxAge) * time.Minute
+		}
+
+		r.mu.Lock()
+		current, ok := r.readings[id]
+		expired := ok && !current.stale && time.Since(current.at) > maxAge
+		if expired {
+			current.stale = true
+			r.readings[id] = current
+		}
+		r.mu.Unlock()
+
+		if expired {
+			slog.Warn("Température de pièce périmée", "applianceID", id, "lastUpdate", current.at)
+			r.mqttClient.PublishState(r.mqttClient.BuildHeaterStateTopic(id).CurrentTemperature, mqtt.TEMPERATURE_NONE)
+		}
+	}
+}
+
+// parseTemperature accepte une valeur numérique brute ou un objet JSON portant un champ "temperature"
+func parseTemperature(data string) (float64, error) {
+	data = strings.TrimSpace(data)
+	if value, err := strconv.ParseFloat(data, 64); err == nil {
+		return value, nil
+	}
+	var payload struct {
+		Temperature *float64 `json:"temperature"`
+	}
+	if err := json.Unmarshal([]byte(data), &payload); err != nil || payload.Temperature == nil {
+		return 0, fmt.Errorf("valeur non reconnue: %q", data)
+	}
+	return *payload.Temperature, nil
+}
+
+func toCelsius(value float64, unit string) float64 {
+	switch strings.ToUpper(strings.TrimPrefix(unit, "°")) {
+	case "F":
+		return (value - 32) * 5 / 9
+	default:
+		return value
+	}
+}
@@ -0,0 +1,142 @@
+package sensors
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/config"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+)
+
+const defaultWindowOpenDelay = 2 * time.Minute
+
+// WindowEvent signale qu'une fenêtre est restée ouverte au-delà du délai configuré (Open=true),
+// ou qu'elle a été refermée après un tel événement (Open=false)
+type WindowEvent struct {
+	ApplianceID int64
+	Open        bool
+}
+
+// Windows surveille les capteurs d'ouverture associés aux radiateurs
+type Windows struct {
+	mqttClient *mqtt.Client
+	heaters    []config.HeaterOptions
+	events     chan WindowEvent
+
+	mu      sync.Mutex
+	windows map[int64]*window
+}
+
+type window struct {
+	open     bool
+	reported bool // l'ouverture a été signalée (délai écoulé)
+	timer    *time.Timer
+}
+
+func NewWindows(mqttClient *mqtt.Client, heaters []config.HeaterOptions) *Windows {
+	return &Windows{
+		mqttClient: mqttClient,
+		heaters:    heaters,
+		events:     make(chan WindowEvent, 16),
+		windows:    make(map[int64]*window),
+	}
+}
+
+// Events retourne le canal des ouvertures/fermetures à traiter
+func (w *Windows) Events() <-chan WindowEvent {
+	return w.events
+}
+
+// Start s'abonne aux capteurs d'ouverture configurés
+func (w *Windows) Start() {
+	for _, heater := range w.heaters {
+		if heater.WindowSensorTopic == "" {
+			continue
+		}
+		heater := heater
+		delay := defaultWindowOpenDelay
+		if heater.WindowOpenDelay > 0 {
+			delay = time.Duration(heater.WindowOpenDelay) * time.Second
+		}
+		w.mqttClient.ListenExternal(heater.WindowSensorTopic, func(data string) {
+			open, err := parseOpening(data)
+			if err != nil {
+				slog.Warn("État de fenêtre invalide", "applianceID", heater.ApplianceID, "topic", heater.WindowSensorTopic, "error", err)
+				return
+			}
+			w.update(int64(heater.ApplianceID), open, delay)
+		})
+	}
+}
+
+// MarkOpen restaure une ouverture déjà signalée avant un redémarrage,
+// pour que la prochaine fermeture déclenche bien la restauration
+func (w *Windows) MarkOpen(id int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.windows[id] = &window{open: true, reported: true}
+}
+
+func (w *Windows) update(id int64, open bool, delay time.Duration) {
+	w.mu.Lock()
+	current, ok := w.windows[id]
+	if !ok {
+		current = &window{}
+		w.windows[id] = current
+	}
+	if current.open == open {
+		w.mu.Unlock()
+		return
+	}
+	current.open = open
+
+	if open {
+		slog.Info("Fenêtre ouverte", "applianceID", id, "delay", delay)
+		current.timer = time.AfterFunc(delay, func() {
+			w.mu.Lock()
+			report := current.open && !current.reported
+			if report {
+				current.reported = true
+			}
+			w.mu.Unlock()
+			if report {
+				w.events <- WindowEvent{ApplianceID: id, Open: true}
+			}
+		})
+		w.mu.Unlock()
+		return
+	}
+
+	slog.Info("Fenêtre fermée", "applianceID", id)
+	if current.timer != nil {
+		current.timer.Stop()
+	}
+	report := current.reported
+	current.reported = false
+	w.mu.Unlock()
+	if report {
+		w.events <- WindowEvent{ApplianceID: id, Open: false}
+	}
+}
+
+// parseOpening interprète les payloads usuels des capteurs d'ouverture :
+// ON/OFF, open/closed, true/false, 1/0 ou un objet JSON zigbee2mqtt portant "contact" (false = ouvert)
+func parseOpening(data string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(data)) {
+	case "on", "open", "opened", "true", "1":
+		return true, nil
+	case "off", "close", "closed", "false", "0":
+		return false, nil
+	}
+	var payload struct {
+		Contact *bool `json:"contact"`
+	}
+	if err := json.Unmarshal([]byte(data), &payload); err != nil || payload.Contact == nil {
+		return false, fmt.Errorf("valeur non reconnue: %q", data)
+	}
+	return !*payload.Contact, nil
+}
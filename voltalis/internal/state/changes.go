@@ -0,0 +1,188 @@
+package state
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// Field identifie un champ de HeaterState ou de ControllerState (nom du champ Go)
+type Field string
+
+const (
+	FieldDuration    Field = "Duration"
+	FieldMode        Field = "Mode"
+	FieldPresetMode  Field = "PresetMode"
+	FieldTemperature Field = "Temperature"
+	FieldProgram     Field = "Program"
+)
+
+// Fields est l'ensemble des champs modifiés d'un état
+type Fields map[Field]struct{}
+
+// NewFields construit un ensemble de champs modifiés
+func NewFields(fields ...Field) Fields {
+	set := make(Fields, len(fields))
+	for _, field := range fields {
+		set[field] = struct{}{}
+	}
+	return set
+}
+
+// Has indique si le champ fait partie des champs modifiés
+func (f Fields) Has(field Field) bool {
+	_, ok := f[field]
+	return ok
+}
+
+// Only indique si les champs modifiés sont exactement ceux donnés
+func (f Fields) Only(fields ...Field) bool {
+	expected := NewFields(fields...)
+	if len(f) != len(expected) {
+		return false
+	}
+	for field := range expected {
+		if !f.Has(field) {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON sérialise l'ensemble comme une liste triée de noms de champs
+func (f Fields) MarshalJSON() ([]byte, error) {
+	return json.Marshal(slices.Sorted(maps.Keys(f)))
+}
+
+// UnmarshalJSON relit la liste de noms de champs produite par MarshalJSON
+func (f *Fields) UnmarshalJSON(data []byte) error {
+	var names []Field
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*f = NewFields(names...)
+	return nil
+}
+
+// Union retourne l'ensemble des champs modifiés dans f ou dans other
+func (f Fields) Union(other Fields) Fields {
+	union := maps.Clone(f)
+	if union == nil {
+		union = make(Fields, len(other))
+	}
+	maps.Copy(union, other)
+	return union
+}
+
+// diffFields compare champ par champ deux structures du même type.
+// La comparaison par réflexion couvre automatiquement les champs ajoutés aux états
+func diffFields[T any](previous, current T) Fields {
+	fields := make(Fields)
+	pv, cv := reflect.ValueOf(previous), reflect.ValueOf(current)
+	for i := range pv.NumField() {
+		if !reflect.DeepEqual(pv.Field(i).Interface(), cv.Field(i).Interface()) {
+			fields[Field(pv.Type().Field(i).Name)] = struct{}{}
+		}
+	}
+	return fields
+}
+
+// HeaterChanged décrit la modification d'un radiateur
+type HeaterChanged struct {
+	ID     int64
+	Old    HeaterState
+	New    HeaterState
+	Fields Fields
+}
+
+// ControllerChanged décrit la modification du contrôleur
+type ControllerChanged struct {
+	Old    ControllerState
+	New    ControllerState
+	Fields Fields
+}
+
+// Changes regroupe les modifications entre deux états globaux
+type Changes struct {
+	// Initial est vrai pour le premier état connu (pas de comparaison possible)
+	Initial        bool
+	Controller     *ControllerChanged
+	Heaters        map[int64]HeaterChanged
+	AddedHeaters   map[int64]HeaterState
+	RemovedHeaters []int64
+}
+
+// Diff calcule les modifications entre deux états globaux
+func Diff(previous, current ResourceState) Changes {
+	var changes Changes
+	if fields := diffFields(previous.ControllerState, current.ControllerState); len(fields) > 0 {
+		changes.Controller = &ControllerChanged{Old: previous.ControllerState, New: current.ControllerState, Fields: fields}
+	}
+	for id := range previous.HeaterState {
+		if _, exists := current.HeaterState[id]; !exists {
+			changes.RemovedHeaters = append(changes.RemovedHeaters, id)
+		}
+	}
+	slices.Sort(changes.RemovedHeaters)
+	for id, currentHeater := range current.HeaterState {
+		previousHeater, exists := previous.HeaterState[id]
+		if !exists {
+			if changes.AddedHeaters == nil {
+				changes.AddedHeaters = make(map[int64]HeaterState)
+			}
+			changes.AddedHeaters[id] = currentHeater
+			continue
+		}
+		if fields := diffFields(previousHeater, currentHeater); len(fields) > 0 {
+			if changes.Heaters == nil {
+				changes.Heaters = make(map[int64]HeaterChanged)
+			}
+			changes.Heaters[id] = HeaterChanged{ID: id, Old: previousHeater, New: currentHeater, Fields: fields}
+		}
+	}
+	return changes
+}
+
+// Empty indique si aucune modification n'a été détectée
+func (c Changes) Empty() bool {
+	return !c.Initial && c.Controller == nil && len(c.Heaters) == 0 && len(c.AddedHeaters) == 0 && len(c.RemovedHeaters) == 0
+}
+
+// Merge fusionne deux modifications successives : l'ancien état est celui de c,
+// le nouvel état celui de newer, et les champs modifiés sont l'union des deux
+func (c Changes) Merge(newer Changes) Changes {
+	merged := Changes{
+		Initial:        c.Initial || newer.Initial,
+		Controller:     c.Controller,
+		Heaters:        maps.Clone(c.Heaters),
+		AddedHeaters:   maps.Clone(c.AddedHeaters),
+		RemovedHeaters: slices.Clone(c.RemovedHeaters),
+	}
+	if newer.Controller != nil {
+		controller := *newer.Controller
+		if c.Controller != nil {
+			controller.Old = c.Controller.Old
+			controller.Fields = c.Controller.Fields.Union(controller.Fields)
+		}
+		merged.Controller = &controller
+	}
+	for id, heater := range newer.Heaters {
+		if merged.Heaters == nil {
+			merged.Heaters = make(map[int64]HeaterChanged)
+		}
+		if older, ok := merged.Heaters[id]; ok {
+			heater.Old = older.Old
+			heater.Fields = older.Fields.Union(heater.Fields)
+		}
+		merged.Heaters[id] = heater
+	}
+	for id, heater := range newer.AddedHeaters {
+		if merged.AddedHeaters == nil {
+			merged.AddedHeaters = make(map[int64]HeaterState)
+		}
+		merged.AddedHeaters[id] = heater
+	}
+	merged.RemovedHeaters = append(merged.RemovedHeaters, newer.RemovedHeaters...)
+	return merged
+}
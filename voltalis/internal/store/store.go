@@ -0,0 +1,113 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persiste des documents JSON dans un répertoire (typiquement /config/voltalis, mappé par l'add-on)
+// afin qu'ils survivent aux redémarrages. Les écritures sont atomiques (fichier temporaire puis rename)
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("impossible de créer le répertoire %s: %w", dir, err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Load lit le document name dans v. Retourne false sans erreur si le document n'existe pas encore
+func (s *Store) Load(name string, v any) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("impossible de lire %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("erreur de parsing JSON de %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// Save écrit le document name de façon atomique
+func (s *Store) Save(name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("impossible de créer le fichier temporaire pour %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("impossible d'écrire %s: %w", name, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("impossible d'écrire %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("impossible d'écrire %s: %w", name, err)
+	}
+	return os.Rename(tmp.Name(), s.path(name))
+}
+
+// versioned enveloppe un document avec la version de son schéma
+type versioned struct {
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// LoadVersioned lit un document enregistré par SaveVersioned. Un document d'une autre version de schéma
+// est ignoré (false avec erreur) plutôt que mal interprété. Un document antérieur au versionnage
+// (écrit par Save) est lu comme la version 1 de son schéma
+func (s *Store) LoadVersioned(name string, version int, v any) (bool, error) {
+	var raw json.RawMessage
+	found, err := s.Load(name, &raw)
+	if err != nil || !found {
+		return false, err
+	}
+	var doc versioned
+	if err := json.Unmarshal(raw, &doc); err != nil || doc.Data == nil {
+		// Document non versionné
+		doc = versioned{Version: 1, Data: raw}
+	}
+	if doc.Version != version {
+		return false, fmt.Errorf("version de schéma de %s non supportée: %d (attendue %d)", name, doc.Version, version)
+	}
+	if err := json.Unmarshal(doc.Data, v); err != nil {
+		return false, fmt.Errorf("erreur de parsing JSON de %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// SaveVersioned écrit le document name de façon atomique, accompagné de la version de son schéma
+func (s *Store) SaveVersioned(name string, version int, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	return s.Save(name, versioned{Version: version, Data: data})
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"encoding/json"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/audit"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+)
+
+// Origines des écritures Voltalis reportées dans le journal d'audit
+const (
+	causeHomeAssistant = "home_assistant"
+	causeResumeProgram = "resume_program"
+	causeWindow        = "window"
+	causeBoostExpiry   = "boost_expiry"
+	causeRegulation    = "regulation"
+	causeConflict      = "conflict_reapply"
+)
+
+// heaterCause accumule les commandes HA et changements d'un radiateur pendant la fenêtre de debounce,
+// pour rattacher le réglage finalement envoyé à tous ses déclencheurs
+type heaterCause struct {
+	commands []audit.Command
+	change   state.HeaterChanged
+}
+
+// recordCauses mémorise les déclencheurs des changements de radiateurs en attente de debounce.
+// Appelé uniquement depuis la boucle Start
+func (b *Bridge) recordCauses(change mqtt.StateChange) {
+	for id, heaterChange := range change.Changes.Heaters {
+		cause, ok := b.causes[id]
+		if !ok {
+			cause = &heaterCause{change: heaterChange}
+			b.causes[id] = cause
+		} else {
+			cause.change.New = heaterChange.New
+			cause.change.Fields = cause.change.Fields.Union(heaterChange.Fields)
+		}
+		cause.commands = append(cause.commands, auditCommands(change.Commands, id)...)
+	}
+}
+
+// takeHeaterCause retourne et oublie les déclencheurs accumulés d'un radiateur
+func (b *Bridge) takeHeaterCause(id int64) audit.Cause {
+	cause, ok := b.causes[id]
+	if !ok {
+		return audit.Cause{Source: causeHomeAssistant}
+	}
+	delete(b.causes, id)
+	return audit.Cause{Source: causeHomeAssistant, Commands: cause.commands, Changes: marshalChanges(cause.change)}
+}
+
+// controllerCause construit les déclencheurs d'un changement du contrôleur
+func controllerCause(change mqtt.StateChange) audit.Cause {
+	return audit.Cause{
+		Source:   causeHomeAssistant,
+		Commands: auditCommands(change.Commands, 0),
+		Changes:  marshalChanges(change.Changes.Controller),
+	}
+}
+
+// withCause exécute apply en rattachant les écritures Voltalis effectuées à cause dans le journal d'audit
+func (b *Bridge) withCause(cause audit.Cause, apply func()) {
+	if b.audit == nil {
+		apply()
+		return
+	}
+	clear := b.audit.SetCause(cause)
+	defer clear()
+	apply()
+}
+
+// auditCommands retient les commandes visant le radiateur heaterID (0 pour le contrôleur)
+func auditCommands(commands []mqtt.Command, heaterID int64) []audit.Command {
+	var result []audit.Command
+	for _, command := range commands {
+		if command.HeaterID == heaterID {
+			result = append(result, audit.Command{Topic: string(command.Topic), Payload: command.Payload, At: command.At})
+		}
+	}
+	return result
+}
+
+func marshalChanges(changes any) json.RawMessage {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return nil
+	}
+	return data
+}
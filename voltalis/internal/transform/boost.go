@@ -0,0 +1,129 @@
+package transform
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+)
+
+const defaultBoostDuration = 30 * time.Minute
+
+// errWindowOpen refuse un boost sur un radiateur dont la fenêtre est ouverte : le forçage Hors-Gel est prioritaire
+var errWindowOpen = errors.New("fenêtre ouverte : boost refusé tant que le Hors-Gel est forcé")
+
+// boostDuration retourne la durée de boost : celle choisie dans HA si elle est limitée,
+// sinon la durée par défaut configurée
+func (b *Bridge) boostDuration(duration string) time.Duration {
+	end, err := mqtt.ParseEndDate(duration, time.Now())
+	if err != nil {
+		slog.Warn("Durée de boost invalide, durée par défaut utilisée", "duration", duration, "error", err)
+	} else if end != nil {
+		return time.Until(*end)
+	}
+	if b.opts.BoostDuration > 0 {
+		return time.Duration(b.opts.BoostDuration) * time.Minute
+	}
+	return defaultBoostDuration
+}
+
+// applyBoost passe le radiateur en Confort pour une durée limitée en mémorisant l'état à restaurer ensuite.
+// Le réglage manuel porte une date de fin, Voltalis le termine donc de lui-même ; expireBoosts restaure
+// en complément l'état précédent exact (réglage manuel antérieur notamment)
+func (b *Bridge) applyBoost(id int64, duration time.Duration, appliances []api.Appliance) error {
+	// Le forçage de la fenêtre et l'état à restaurer à sa fermeture restent en place
+	if ov, ok := b.overrides.get(id); ok && ov.Reason == overrideWindow {
+		return errWindowOpen
+	}
+	until := time.Now().Add(duration)
+	end := b.apiClient.FormatDate(until)
+	tempTarget := 0.0
+	for _, app := range appliances {
+		if int64(app.ID) == id {
+			tempTarget = app.Programming.DefaultTemperature
+		}
+	}
+	request := api.UpdateManualSettingRequest{
+		Enabled:            true,
+		IDAppliance:        int(id),
+		UntilFurtherNotice: false,
+		IsOn:               true,
+		EndDate:            &end,
+	}
+	request.Mode, request.TemperatureTarget = withPresetTemperature(b.opts.Heater(int(id)), "CONFORT", tempTarget)
+	if err := b.applyOverride(id, overrideBoost, until, request); err != nil {
+		return err
+	}
+	slog.Info("Boost activé", "heaterID", id, "until", until)
+	return nil
+}
+
+// boostAll applique le boost à tous les radiateurs (mode Boost du contrôleur)
+func (b *Bridge) boostAll(duration time.Duration, appliances []api.Appliance) bool {
+	applied := false
+	for _, app := range appliances {
+		if err := b.applyBoost(int64(app.ID), duration, appliances); err != nil {
+			slog.Error("failed to apply boost", "heaterID", app.ID, "error", err)
+			continue
+		}
+		applied = true
+	}
+	return applied
+}
+
+// cancelBoosts restaure l'état précédent de tous les radiateurs en boost
+func (b *Bridge) cancelBoosts() bool {
+	applied := false
+	for _, id := range b.overrides.ids(overrideBoost) {
+		restored, err := b.restoreOverride(id, overrideBoost)
+		if err != nil {
+			slog.Error("failed to cancel boost", "heaterID", id, "error", err)
+		}
+		if restored {
+			applied = true
+		}
+	}
+	return applied
+}
+
+// expireBoosts restaure l'état précédent des radiateurs dont le boost est terminé
+// Retourne les radiateurs pour lesquels des changements ont été appliqués côté Voltalis
+func (b *Bridge) expireBoosts() []int64 {
+	var applied []int64
+	for _, id := range b.overrides.ids(overrideBoost) {
+		ov, _ := b.overrides.get(id)
+		if time.Now().Before(ov.Until) {
+			continue
+		}
+		slog.Info("Fin du boost", "heaterID", id)
+		restored, err := b.restoreOverride(id, overrideBoost)
+		if err != nil {
+			slog.Error("failed to restore heater after boost", "heaterID", id, "error", err)
+		}
+		if restored {
+			applied = append(applied, id)
+		}
+	}
+	return applied
+}
+
+// boostRemaining retourne le nombre de minutes de boost restantes (0 si pas de boost)
+func (b *Bridge) boostRemaining(id int64) int {
+	ov, ok := b.overrides.get(id)
+	if !ok || ov.Reason != overrideBoost {
+		return 0
+	}
+	return int(math.Ceil(math.Max(0, time.Until(ov.Until).Minutes())))
+}
+
+// displayBoost affiche le preset Boost pour un radiateur en boost
+func (b *Bridge) displayBoost(id int64, heaterState *state.HeaterState) {
+	if b.boostRemaining(id) > 0 {
+		heaterState.Mode = state.HeaterModeAuto
+		heaterState.PresetMode = state.HeaterPresetModeBoost
+	}
+}
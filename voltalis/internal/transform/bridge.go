@@ -0,0 +1,105 @@
+package transform
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/audit"
+	"github.com/francois76/voltalis-integration/voltalis/internal/config"
+	"github.com/francois76/voltalis-integration/voltalis/internal/homeassistant"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+	"github.com/francois76/voltalis-integration/voltalis/internal/sensors"
+	"github.com/francois76/voltalis-integration/voltalis/internal/store"
+)
+
+// Bridge porte l'état partagé entre la synchronisation Voltalis -> HA (appelée par le scheduler)
+// et le traitement des commandes HA -> Voltalis (boucle Start)
+type Bridge struct {
+	mqttClient *mqtt.Client
+	apiClient  voltalisClient
+	opts       *config.Options
+
+	store *store.Store
+	// audit journalise les écritures Voltalis avec leur déclencheur (nil si désactivé)
+	audit *audit.Log
+	// causes accumule les déclencheurs des commandes de radiateurs en attente de debounce
+	causes map[int64]*heaterCause
+
+	roomTemperatures *sensors.RoomTemperatures
+	regulator        *regulator
+	windows          *sensors.Windows
+	overrides        *overrides
+
+	// programmings mémorise la dernière programmation publiée de chaque radiateur
+	programmings *programmings
+	// writes mémorise les écritures de l'add-on sur chaque radiateur pas encore constatées chez Voltalis
+	writes *writeTracker
+	// dryRun indique que les écritures sont simulées : aucune relecture ne peut les confirmer
+	dryRun bool
+
+	// debouncer regroupe les commandes HA rapprochées de chaque radiateur
+	debouncer *debouncer
+	// pending suit les commandes HA affichées de façon optimiste en attente de confirmation
+	pending *pendingCommands
+
+	// resumeRequests transmet les demandes de retour à la programmation (boutons) à la boucle Start
+	resumeRequests chan []int64
+	// reapplies accumule les demandes HA à réappliquer après un changement externe, traitées par la boucle Start
+	reapplies *reapplyQueue
+}
+
+// NewBridge crée le pont entre Voltalis et HA. st peut être nil : l'add-on fonctionne alors
+// mais oublie les forçages en cours à chaque redémarrage
+func NewBridge(mqttClient *mqtt.Client, apiClient *api.Client, haClient *homeassistant.Client, st *store.Store, auditLog *audit.Log, opts *config.Options) *Bridge {
+	debounce := orDefault(time.Duration(opts.DebounceMs)*time.Millisecond, defaultDebounce)
+	b := &Bridge{
+		mqttClient:       mqttClient,
+		opts:             opts,
+		store:            st,
+		audit:            auditLog,
+		causes:           make(map[int64]*heaterCause),
+		roomTemperatures: sensors.NewRoomTemperatures(mqttClient, haClient, opts.Heaters),
+		regulator:        newRegulator(opts.Heaters),
+		windows:          sensors.NewWindows(mqttClient, opts.Heaters),
+		overrides:        loadOverrides(st),
+		programmings:     &programmings{heaters: make(map[int64]api.Programming), seen: make(map[int64]time.Time)},
+		debouncer:        newDebouncer(debounce),
+		pending:          newPendingCommands(debounce),
+		resumeRequests:   make(chan []int64, 10),
+		reapplies:        newReapplyQueue(),
+	}
+	var client voltalisClient = apiClient
+	if opts.ReadOnly {
+		slog.Warn("Mode lecture seule : aucune commande ne sera envoyée à Voltalis")
+		client = readOnlyClient{client}
+	} else if opts.DryRun {
+		slog.Warn("Mode simulation : les commandes sont publiées sur le topic de debug sans être envoyées à Voltalis", "topic", dryRunTopic)
+		client = dryRunClient{voltalisClient: client, mqttClient: mqttClient}
+		b.dryRun = true
+	}
+	// Toutes les écritures vers Voltalis passent par les règles de sécurité, puis sont mémorisées
+	// pour distinguer les changements de l'add-on de ceux faits dans l'application Voltalis
+	b.writes = newWriteTracker(client)
+	b.apiClient = newPolicyClient(b.writes, opts.Policies, b.reportViolation)
+	return b
+}
+
+// voltalisClient regroupe les appels à l'API Voltalis utilisés par le bridge.
+// Il est implémenté par api.Client et peut être décoré (règles de sécurité...)
+type voltalisClient interface {
+	GetAppliances() ([]api.Appliance, error)
+	GetAppliance(applianceID int) (*api.Appliance, error)
+	GetManualSettings() ([]api.ManualSetting, error)
+	GetPrograms() ([]api.Program, error)
+	GetQuickSettings() ([]api.QuickSettings, error)
+
+	CreateManualSetting(request api.UpdateManualSettingRequest) (*api.ManualSetting, error)
+	UpdateManualSetting(manualSettingID int, request api.UpdateManualSettingRequest) error
+	UpdateQuickSettings(qsID int, qs api.QuickSettings) error
+	EnableQuickSetting(qsID int, enabled bool) error
+	UpdateProgram(programID int, request api.UpdateProgramRequest) error
+
+	FormatDate(t time.Time) string
+	ParseDate(value string) (time.Time, error)
+}
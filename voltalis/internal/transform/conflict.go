@@ -0,0 +1,105 @@
+package transform
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+)
+
+// Arbitrages possibles entre la dernière demande HA et un changement fait hors de HA (option conflict_policy)
+const (
+	conflictVoltalis      = "voltalis"
+	conflictHomeAssistant = "home_assistant"
+	conflictLastWriter    = "last_writer"
+)
+
+// reapplyRequest est une demande HA à renvoyer à Voltalis après un changement externe
+type reapplyRequest struct {
+	id     int64
+	state  state.HeaterState
+	fields state.Fields
+}
+
+// reapplyQueue transmet les réapplications de la synchronisation à la boucle Start sans jamais bloquer le scheduler :
+// les demandes sont accumulées (la plus récente par radiateur) et la boucle est seulement réveillée
+type reapplyQueue struct {
+	mu       sync.Mutex
+	requests map[int64]reapplyRequest
+	ready    chan struct{}
+}
+
+func newReapplyQueue() *reapplyQueue {
+	return &reapplyQueue{requests: make(map[int64]reapplyRequest), ready: make(chan struct{}, 1)}
+}
+
+func (q *reapplyQueue) add(request reapplyRequest) {
+	q.mu.Lock()
+	q.requests[request.id] = request
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+		// Un réveil est déjà en attente, il emportera cette demande
+	}
+}
+
+// Ready signale des demandes à traiter
+func (q *reapplyQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// take retourne les demandes accumulées, par radiateur, et vide la file
+func (q *reapplyQueue) take() []reapplyRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	requests := make([]reapplyRequest, 0, len(q.requests))
+	for _, id := range slices.Sorted(maps.Keys(q.requests)) {
+		requests = append(requests, q.requests[id])
+	}
+	clear(q.requests)
+	return requests
+}
+
+// resolveConflict décide si la dernière demande HA d'un radiateur doit être réappliquée après un changement externe.
+// changedAfter est la dernière fois où l'ancienne programmation a été constatée : le changement externe est postérieur
+func (b *Bridge) resolveConflict(id int64, changedAfter time.Time) (reapplyRequest, bool) {
+	intent, ok := b.mqttClient.StateManager.Intent(id)
+	if !ok || len(intent.Fields) == 0 {
+		return reapplyRequest{}, false
+	}
+	switch b.opts.ConflictPolicy {
+	case conflictHomeAssistant:
+	case conflictLastWriter:
+		// Voltalis ne date pas ses programmations : HA n'est le dernier à écrire que si sa demande
+		// a été reçue après la dernière lecture de l'ancienne programmation
+		if !intent.At.After(changedAfter) {
+			return reapplyRequest{}, false
+		}
+	default:
+		return reapplyRequest{}, false
+	}
+	if _, active := b.overrides.get(id); active {
+		// Un boost ou une fenêtre ouverte pilote le radiateur : la demande HA n'est plus la dernière consigne
+		return reapplyRequest{}, false
+	}
+	desired := intent.State
+	end, err := mqtt.ParseEndDate(desired.Duration, intent.At)
+	if err != nil {
+		slog.Debug("Demande HA sans échéance valide, pas de réapplication", "heaterID", id, "error", err)
+		return reapplyRequest{}, false
+	}
+	if end != nil {
+		if !end.After(time.Now()) {
+			slog.Debug("Demande HA arrivée à échéance, pas de réapplication", "heaterID", id, "end", end)
+			return reapplyRequest{}, false
+		}
+		// La demande réappliquée conserve son échéance d'origine
+		desired.Duration = mqtt.EndDateName(*end)
+	}
+	return reapplyRequest{id: id, state: desired, fields: intent.Fields}, true
+}
@@ -0,0 +1,64 @@
+package transform
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+)
+
+const defaultDebounce = time.Second
+
+// debouncer regroupe les commandes HA rapprochées d'un même radiateur (curseur de consigne, mode puis preset...)
+// pour n'envoyer qu'un seul réglage manuel correspondant à l'état final demandé
+type debouncer struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	heaters map[int64]state.Fields
+	timers  map[int64]*time.Timer
+	ready   chan int64
+}
+
+func newDebouncer(delay time.Duration) *debouncer {
+	return &debouncer{
+		delay:   delay,
+		heaters: make(map[int64]state.Fields),
+		timers:  make(map[int64]*time.Timer),
+		ready:   make(chan int64, 10),
+	}
+}
+
+// add fusionne les champs modifiés d'un radiateur avec ceux déjà en attente et relance la fenêtre.
+// Retourne l'ensemble des champs modifiés depuis l'ouverture de la fenêtre
+func (d *debouncer) add(id int64, changes state.Fields) state.Fields {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	merged := d.heaters[id].Union(changes)
+	d.heaters[id] = merged
+	if timer, ok := d.timers[id]; ok {
+		timer.Stop()
+	}
+	d.timers[id] = time.AfterFunc(d.delay, func() {
+		d.ready <- id
+	})
+	return maps.Clone(merged)
+}
+
+// take retourne et oublie les changements en attente d'un radiateur (nil s'ils ont déjà été traités)
+func (d *debouncer) take(id int64) state.Fields {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	merged, ok := d.heaters[id]
+	if !ok {
+		return nil
+	}
+	delete(d.heaters, id)
+	delete(d.timers, id)
+	return merged
+}
+
+// Ready signale les radiateurs dont la fenêtre de regroupement est écoulée
+func (d *debouncer) Ready() <-chan int64 {
+	return d.ready
+}
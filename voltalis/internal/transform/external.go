@@ -0,0 +1,146 @@
+package transform
+
+import (
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+)
+
+// sourceVoltalisApp identifie les changements faits hors de HA, depuis l'application ou le site Voltalis
+const sourceVoltalisApp = "voltalis_app"
+
+// writeTracker mémorise les écritures de l'add-on sur chaque radiateur qui n'ont pas encore été constatées chez Voltalis,
+// afin de distinguer ses propres changements de ceux faits dans l'application Voltalis.
+// Une écriture est confirmée à la fin de la relecture qui la suit, ou dès qu'un changement de programmation lui est attribué
+type writeTracker struct {
+	voltalisClient
+	mu      sync.Mutex
+	heaters map[int]time.Time
+	// les quicksettings et programmes concernent tous les radiateurs
+	all       time.Time
+	confirmed map[int]time.Time
+}
+
+func newWriteTracker(client voltalisClient) *writeTracker {
+	return &writeTracker{voltalisClient: client, heaters: make(map[int]time.Time), confirmed: make(map[int]time.Time)}
+}
+func (t *writeTracker) CreateManualSetting(request api.UpdateManualSettingRequest) (*api.ManualSetting, error) {
+	t.mark(request.IDAppliance)
+	return t.voltalisClient.CreateManualSetting(request)
+}
+
+func (t *writeTracker) UpdateManualSetting(manualSettingID int, request api.UpdateManualSettingRequest) error {
+	t.mark(request.IDAppliance)
+	return t.voltalisClient.UpdateManualSetting(manualSettingID, request)
+}
+
+func (t *writeTracker) UpdateQuickSettings(qsID int, qs api.QuickSettings) error {
+	t.markAll()
+	return t.voltalisClient.UpdateQuickSettings(qsID, qs)
+}
+
+func (t *writeTracker) EnableQuickSetting(qsID int, enabled bool) error {
+	t.markAll()
+	return t.voltalisClient.EnableQuickSetting(qsID, enabled)
+}
+
+func (t *writeTracker) UpdateProgram(programID int, request api.UpdateProgramRequest) error {
+	t.markAll()
+	return t.voltalisClient.UpdateProgram(programID, request)
+}
+
+func (t *writeTracker) mark(applianceID int) {
+	t.mu.Lock()
+	t.heaters[applianceID] = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *writeTracker) markAll() {
+	t.mu.Lock()
+	t.all = time.Now()
+	t.mu.Unlock()
+}
+
+// unconfirmed indique si une écriture de l'add-on sur le radiateur attend encore d'être constatée chez Voltalis.
+// Une écriture sans effet visible n'est plus attendue au-delà de pendingTimeout
+func (t *writeTracker) unconfirmed(applianceID int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last := t.heaters[applianceID]
+	if t.all.After(last) {
+		last = t.all
+	}
+	return !last.IsZero() && last.After(t.confirmed[applianceID]) && time.Since(last) < pendingTimeout
+}
+
+// confirm marque les écritures de l'add-on sur le radiateur comme constatées :
+// tout changement de programmation ultérieur est attribué à l'application Voltalis
+func (t *writeTracker) confirm(applianceID int) {
+	t.mu.Lock()
+	t.confirmed[applianceID] = time.Now()
+	t.mu.Unlock()
+}
+
+// detectExternalChange signale dans HA un radiateur dont la programmation a changé sans commande de l'add-on,
+// et retourne la demande HA à réappliquer si la politique de conflit lui donne raison
+func (b *Bridge) detectExternalChange(appliance api.Appliance, previous, current state.HeaterState) (reapplyRequest, bool) {
+	id := int64(appliance.ID)
+	known, ok := b.programmings.get(id)
+	if !ok || !externalProgrammingChange(b.apiClient, known, appliance.Programming) {
+		return reapplyRequest{}, false
+	}
+	if b.writes.unconfirmed(appliance.ID) {
+		// Changement attendu après une écriture de l'add-on : il la confirme
+		b.writes.confirm(appliance.ID)
+		return reapplyRequest{}, false
+	}
+	request, reapply := b.resolveConflict(id, b.programmings.seenAt(id))
+	resolution := conflictVoltalis
+	if reapply {
+		resolution = conflictHomeAssistant
+	} else {
+		// L'état Voltalis est adopté : la demande HA qu'il remplace ne sera plus réappliquée
+		b.mqttClient.StateManager.ClearIntent(id)
+	}
+	slog.Info("Changement externe détecté", "heaterID", id, "old", known, "new", appliance.Programming, "resolution", resolution)
+	b.mqttClient.PublishEvent(b.mqttClient.BuildHeaterStateTopic(id).ExternalChange, mqtt.EventExternalChange, map[string]any{
+		"heater_id":  id,
+		"heater":     appliance.Name,
+		"source":     sourceVoltalisApp,
+		"old":        eventState(previous),
+		"new":        eventState(current),
+		"resolution": resolution,
+	})
+	return request, reapply
+}
+
+// externalProgrammingChange indique si le passage d'une programmation à l'autre résulte d'une action
+// de l'utilisateur plutôt que du déroulement normal : changement de créneau d'un programme ou fin d'un réglage temporaire
+func externalProgrammingChange(apiClient voltalisClient, previous, current api.Programming) bool {
+	switch {
+	case reflect.DeepEqual(previous, current):
+		return false
+	case previous.ProgType == current.ProgType && previous.ProgName == current.ProgName && previous.IDManualSetting == nil && current.IDManualSetting == nil &&
+		(current.ProgType == "USER" || current.ProgType == "DEFAULT"):
+		// Créneau suivant du même programme
+		return false
+	case previous.ProgType != current.ProgType && endDatePassed(apiClient, previous.EndDate):
+		// Réglage manuel ou quicksetting arrivé à échéance
+		return false
+	}
+	return true
+}
+
+// eventState présente l'état d'un radiateur dans les attributs d'un événement
+func eventState(heaterState state.HeaterState) map[string]any {
+	return map[string]any{
+		"mode":        heaterState.Mode,
+		"preset_mode": heaterState.PresetMode,
+		"temperature": heaterState.Temperature,
+	}
+}
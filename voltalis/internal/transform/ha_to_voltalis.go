@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/audit"
+	"github.com/francois76/voltalis-integration/voltalis/internal/config"
 	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
 	"github.com/francois76/voltalis-integration/voltalis/internal/scheduler"
 	"github.com/francois76/voltalis-integration/voltalis/internal/state"
@@ -33,7 +35,8 @@ var haPresetToVoltalisMode = map[state.HeaterPresetMode]string{
 }
 
 // Start est le point de démarrage de la fonction qui process les évenements MQTT de façon globalisée et appelle les APIs de voltalis pour répliquer les changements
-func Start(ctx context.Context, mqttClient *mqtt.Client, apiClient *api.Client, schedule *scheduler.Scheduler) error {
+func (b *Bridge) Start(ctx context.Context, schedule *scheduler.Scheduler) error {
+	mqttClient, apiClient := b.mqttClient, b.apiClient
 	controller, err := mqttClient.RegisterController()
 	if err != nil {
 		return err
@@ -43,7 +46,8 @@ func Start(ctx context.Context, mqttClient *mqtt.Client, apiClient *api.Client,
 		return err
 	}
 
-	controller.ListenState(controller.SetTopics.Refresh, func(currentState *state.ResourceState, data string) {
+	// Le rafraîchissement ne modifie rien côté Voltalis : il reste disponible en lecture seule
+	mqttClient.ListenExternal(string(controller.SetTopics.Refresh), func(data string) {
 		if err := syncPrograms(controller, apiClient); err != nil {
 			slog.Error("failed to refresh programs: " + err.Error())
 		}
@@ -54,11 +58,31 @@ func Start(ctx context.Context, mqttClient *mqtt.Client, apiClient *api.Client,
 	if err != nil {
 		return err
 	}
+	allIDs := make([]int64, 0, len(appliances))
 	for _, appliance := range appliances {
-		if err := mqttClient.RegisterHeater(int64(appliance.ID), appliance.Name); err != nil {
+		id := int64(appliance.ID)
+		if err := mqttClient.RegisterHeater(id, appliance.Name, heaterSettings(appliance, b.opts.Heater(appliance.ID))); err != nil {
 			return err
 		}
+		checkPresetTemperatures(appliance, b.opts.Heater(appliance.ID))
+		allIDs = append(allIDs, id)
+		// Les boutons ne modifient pas l'état : la demande est traitée dans la boucle ci-dessous
+		mqttClient.ListenButton(mqttClient.BuildHeaterCommandTopic(id).ResumeProgram, mqttClient.BuildHeaterStateTopic(id).Errors, func() {
+			b.resumeRequests <- []int64{id}
+		})
 	}
+	mqttClient.ListenButton(controller.SetTopics.ResumeProgram, controller.GetTopics.Errors, func() {
+		b.resumeRequests <- allIDs
+	})
+
+	// Relayer les températures de pièce une fois les radiateurs déclarés
+	b.roomTemperatures.Start(ctx)
+
+	// Surveiller les fenêtres, en reprenant les ouvertures en cours avant un redémarrage
+	for _, id := range b.overrides.ids(overrideWindow) {
+		b.windows.MarkOpen(id)
+	}
+	b.windows.Start()
 
 	// Marquer que toutes les subscriptions initiales sont terminées
 	// Cela permet au client MQTT de se réabonner après une reconnexion
@@ -79,46 +103,102 @@ func Start(ctx context.Context, mqttClient *mqtt.Client, apiClient *api.Client,
 
 	stateChanges := mqttClient.StateManager.Subscribe()
 
+	// Boucle périodique : régulation des radiateurs pilotés par une sonde de pièce et fin des boosts
+	ticker := time.NewTicker(regulationInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case change := <-stateChanges:
 			// Ignorer l'état initial au démarrage - ce n'est pas un changement utilisateur
-			if _, isInitial := change.ChangedFields["initial_state"]; isInitial {
+			if change.Changes.Initial {
 				slog.Debug("État initial ignoré")
 				continue
 			}
 
-			slog.With("change", change.ChangedFields).Debug("champs modifiés")
-
-			// Détecter si on a des changements de radiateurs
-			heaterChanges, hasHeaterChanges := change.ChangedFields["HeaterState"].(map[string]interface{})
+			slog.With("change", change.Changes).Debug("champs modifiés")
 
-			// Traitement des changements des radiateurs individuels EN PREMIER
-			// (car ils peuvent causer des effets de bord sur le programme)
-			var heaterApplied bool
-			if hasHeaterChanges {
-				var err error
-				heaterApplied, err = handleHeaterChanges(apiClient, heaterChanges, change.CurrentState, quickSettings, appliances)
-				if err != nil {
-					slog.Error("failed to apply heater changes to Voltalis", "error", err)
-				}
+			// Les changements des radiateurs individuels sont regroupés par radiateur pendant la fenêtre de debounce,
+			// puis appliqués d'un bloc à partir de l'état final demandé. Ils restent affichés comme en attente d'ici là
+			for heaterID, heaterChange := range change.Changes.Heaters {
+				merged := b.debouncer.add(heaterID, heaterChange.Fields)
+				b.pending.add(heaterID, heaterChange.New, merged)
 			}
+			b.recordCauses(change)
 
 			// Traitement des changements du contrôleur
 			var controllerApplied bool
-			if controllerChanges, ok := change.ChangedFields["ControllerState"].(map[string]interface{}); ok {
+			if controllerChange := change.Changes.Controller; controllerChange != nil {
 				var err error
-				controllerApplied, err = handleControllerChanges(apiClient, controllerChanges, change.CurrentState, programs, quickSettings, appliances)
+				b.withCause(controllerCause(change), func() {
+					controllerApplied, err = b.handleControllerChanges(*controllerChange, change.CurrentState, programs, quickSettings, appliances)
+				})
 				if err != nil {
 					slog.Error("failed to apply controller changes to Voltalis", "error", err)
+					mqttClient.PublishEvent(controller.GetTopics.Errors, mqtt.EventCommandFailed, map[string]any{
+						"message": err.Error(),
+					})
+					// La synchronisation complète republie l'état réel à la place de l'affichage optimiste
+					controllerApplied = true
 				}
 			}
 
-			// Refresh après application des changements uniquement si des changements ont été faits
-			if heaterApplied || controllerApplied {
+			// Refresh après application des changements uniquement si des changements ont été faits :
+			// un changement du contrôleur concerne tous les radiateurs et passe par la synchronisation complète
+			if controllerApplied {
 				schedule.Trigger()
 			}
 
+		case heaterID := <-b.debouncer.Ready():
+			fields := b.debouncer.take(heaterID)
+			if fields == nil {
+				continue
+			}
+			var refresh, rollback []int64
+			b.withCause(b.takeHeaterCause(heaterID), func() {
+				refresh, rollback = b.handleHeaterChanges(map[int64]state.Fields{heaterID: fields}, mqttClient.StateManager.GetCurrentState(), appliances)
+			})
+			b.refreshAppliances(ctx, refresh)
+			b.rollbackAppliances(ctx, rollback)
+
+		case ids := <-b.resumeRequests:
+			b.withCause(audit.Cause{Source: causeResumeProgram}, func() {
+				b.refreshAppliances(ctx, b.resumePrograms(ids))
+			})
+
+		case <-b.reapplies.Ready():
+			modified := make(map[int64]state.Fields)
+			for _, request := range b.reapplies.take() {
+				slog.Info("Réapplication de la demande HA après un changement externe", "heaterID", request.id)
+				modified[request.id] = request.fields
+			}
+			if len(modified) == 0 {
+				continue
+			}
+			var refresh, rollback []int64
+			b.withCause(audit.Cause{Source: causeConflict}, func() {
+				refresh, rollback = b.handleHeaterChanges(modified, mqttClient.StateManager.GetCurrentState(), appliances)
+			})
+			b.refreshAppliances(ctx, refresh)
+			b.rollbackAppliances(ctx, rollback)
+
+		case event := <-b.windows.Events():
+			b.withCause(audit.Cause{Source: causeWindow}, func() {
+				if b.handleWindow(event, appliances) {
+					b.refreshAppliances(ctx, []int64{event.ApplianceID})
+				}
+			})
+
+		case <-ticker.C:
+			var refresh []int64
+			b.withCause(audit.Cause{Source: causeBoostExpiry}, func() {
+				refresh = b.expireBoosts()
+			})
+			b.withCause(audit.Cause{Source: causeRegulation}, func() {
+				refresh = append(refresh, b.regulate(appliances)...)
+			})
+			b.refreshAppliances(ctx, refresh)
+
 		case <-ctx.Done():
 			slog.Warn("context killed")
 			return nil
@@ -129,11 +209,13 @@ func Start(ctx context.Context, mqttClient *mqtt.Client, apiClient *api.Client,
 
 // handleControllerChanges traite les changements du contrôleur global
 // Retourne true si des changements ont été appliqués côté Voltalis
-func handleControllerChanges(apiClient *api.Client, changes map[string]interface{}, currentState state.ResourceState, programs []api.Program, quickSettings []api.QuickSettings, appliances []api.Appliance) (bool, error) {
+func (b *Bridge) handleControllerChanges(change state.ControllerChanged, currentState state.ResourceState, programs []api.Program, quickSettings []api.QuickSettings, appliances []api.Appliance) (bool, error) {
+	apiClient := b.apiClient
 	applied := false
 
 	// Changement de programme
-	if newProgram, ok := changes["Program"].(string); ok {
+	if change.Fields.Has(state.FieldProgram) {
+		newProgram := change.New.Program
 		slog.Info("Programme changé", "nouveau", newProgram)
 		if err := handleProgramChange(apiClient, newProgram, programs); err != nil {
 			return false, err
@@ -141,22 +223,34 @@ func handleControllerChanges(apiClient *api.Client, changes map[string]interface
 		applied = true
 	}
 
+	// Boost global : Confort temporaire sur tous les radiateurs (pas de quicksetting correspondant)
+	if (change.Fields.Has(state.FieldMode) && change.New.Mode == state.HeaterPresetModeBoost) ||
+		(change.Fields.Has(state.FieldDuration) && currentState.ControllerState.Mode == state.HeaterPresetModeBoost) {
+		slog.Info("Boost global demandé", "durée", currentState.ControllerState.Duration)
+		return b.boostAll(b.boostDuration(currentState.ControllerState.Duration), appliances) || applied, nil
+	}
+
 	// Changement de mode global (quicksettings)
-	if newMode, ok := changes["Mode"].(state.HeaterPresetMode); ok {
+	if change.Fields.Has(state.FieldMode) {
+		newMode := change.New.Mode
 		slog.Info("Mode global changé", "nouveau", newMode)
+		// Quitter le mode Boost restaure l'état précédent des radiateurs avant d'appliquer le nouveau mode
+		if b.cancelBoosts() {
+			applied = true
+		}
 		duration := currentState.ControllerState.Duration
-		if err := handleModeChange(apiClient, newMode, duration, quickSettings, appliances); err != nil {
+		if err := handleModeChange(apiClient, b.opts, newMode, duration, quickSettings, appliances); err != nil {
 			return false, err
 		}
 		applied = true
 	}
 
 	// Changement de durée (sans changement de mode = mise à jour du quicksetting actuel)
-	if _, hasDuration := changes["Duration"]; hasDuration {
-		if _, hasMode := changes["Mode"]; !hasMode {
+	if change.Fields.Has(state.FieldDuration) {
+		if !change.Fields.Has(state.FieldMode) {
 			// Durée changée sans changement de mode
 			slog.Info("Durée changée", "nouvelle", currentState.ControllerState.Duration)
-			if err := handleModeChange(apiClient, currentState.ControllerState.Mode, currentState.ControllerState.Duration, quickSettings, appliances); err != nil {
+			if err := handleModeChange(apiClient, b.opts, currentState.ControllerState.Mode, currentState.ControllerState.Duration, quickSettings, appliances); err != nil {
 				return false, err
 			}
 			applied = true
@@ -167,7 +261,14 @@ func handleControllerChanges(apiClient *api.Client, changes map[string]interface
 }
 
 // handleProgramChange gère le changement de programme
-func handleProgramChange(apiClient *api.Client, programName string, programs []api.Program) error {
+func handleProgramChange(apiClient voltalisClient, programName string, programs []api.Program) error {
+	// Un programme interdit est refusé avant de désactiver le programme en cours
+	if policy, ok := apiClient.(programPolicy); ok && programName != "Aucun programme" {
+		if err := policy.checkProgram(programName); err != nil {
+			return err
+		}
+	}
+
 	// Désactiver tous les programmes d'abord
 	for _, p := range programs {
 		if p.Enabled {
@@ -211,7 +312,7 @@ func handleProgramChange(apiClient *api.Client, programName string, programs []a
 }
 
 // handleModeChange gère le changement de mode global (quicksettings)
-func handleModeChange(apiClient *api.Client, mode state.HeaterPresetMode, duration string, quickSettings []api.QuickSettings, appliances []api.Appliance) error {
+func handleModeChange(apiClient voltalisClient, opts *config.Options, mode state.HeaterPresetMode, duration string, quickSettings []api.QuickSettings, appliances []api.Appliance) error {
 	// Si mode "Aucun mode", désactiver tous les quicksettings
 	if mode == state.HeaterPresetModeAucunMode {
 		for _, qs := range quickSettings {
@@ -252,29 +353,21 @@ func handleModeChange(apiClient *api.Client, mode state.HeaterPresetMode, durati
 	voltalisMode := haPresetToVoltalisMode[mode]
 
 	for _, app := range appliances {
+		appMode, tempTarget := withPresetTemperature(opts.Heater(app.ID), voltalisMode, app.Programming.DefaultTemperature)
 		appSettings = append(appSettings, api.ApplianceSetting{
 			IDAppliance:       app.ID,
 			ApplianceName:     app.Name,
 			ApplianceType:     app.ApplianceType,
-			Mode:              voltalisMode,
-			TemperatureTarget: app.Programming.DefaultTemperature,
+			Mode:              appMode,
+			TemperatureTarget: tempTarget,
 			IsOn:              true,
 		})
 	}
 
 	// Calculer untilFurtherNotice et modeEndDate en fonction de la durée
-	untilFurtherNotice := true
-	var modeEndDate *string
-
-	if duration != "" && duration != "Jusqu'à ce que je change d'avis" {
-		untilFurtherNotice = false
-		// Parser la durée depuis les constantes MQTT
-		parsedDuration := parseDuration(duration)
-		if parsedDuration > 0 {
-			// Format sans timezone comme attendu par l'API Voltalis
-			end := time.Now().Add(parsedDuration).Format("2006-01-02T15:04:05")
-			modeEndDate = &end
-		}
+	untilFurtherNotice, modeEndDate, err := endDateFromDuration(apiClient, duration)
+	if err != nil {
+		return err
 	}
 
 	// Étape 1: Mettre à jour le quicksetting (sans enabled)
@@ -300,42 +393,79 @@ func handleModeChange(apiClient *api.Client, mode state.HeaterPresetMode, durati
 	return nil
 }
 
-// handleHeaterChanges traite les changements individuels des radiateurs
-// Retourne true si des changements ont été appliqués côté Voltalis
-func handleHeaterChanges(apiClient *api.Client, changes map[string]interface{}, currentState state.ResourceState, quickSettings []api.QuickSettings, appliances []api.Appliance) (bool, error) {
-	applied := false
+// handleHeaterChanges traite les changements des radiateurs individuels.
+// Chaque commande est marquée en attente jusqu'à sa confirmation par une relecture du radiateur.
+// Retourne les radiateurs à relire pour confirmation, et ceux dont la commande a échoué et dont l'état réel doit être republié
+func (b *Bridge) handleHeaterChanges(modified map[int64]state.Fields, currentState state.ResourceState, appliances []api.Appliance) (refresh []int64, rollback []int64) {
+	apiClient := b.apiClient
+
+	for heaterID, heaterChanges := range modified {
+		b.pending.add(heaterID, currentState.HeaterState[heaterID], heaterChanges)
+	}
 
 	// Charger les manualSettings pour avoir les IDs
 	manualSettings, err := apiClient.GetManualSettings()
 	if err != nil {
 		slog.Error("failed to load manual settings", "error", err)
-		return false, err
+		for heaterID := range modified {
+			b.failCommand(heaterID, mqtt.EventCommandFailed, err)
+			rollback = append(rollback, heaterID)
+		}
+		return nil, rollback
 	}
 
 	// Traiter les modifications
-	if modified, ok := changes["modified"].(map[int64]map[string]interface{}); ok {
-		for heaterID, heaterChanges := range modified {
-			slog.Info("Radiateur modifié", "id", heaterID, "changes", heaterChanges)
+	for heaterID, heaterChanges := range modified {
+		slog.Info("Radiateur modifié", "id", heaterID, "changes", heaterChanges)
 
-			heaterState := currentState.HeaterState[heaterID]
+		heaterState := currentState.HeaterState[heaterID]
 
-			// Pour les changements individuels de radiateurs, on utilise manualsetting
-			wasApplied, err := handleSingleHeaterChange(apiClient, int(heaterID), heaterState, heaterChanges, manualSettings, appliances)
-			if err != nil {
-				slog.Error("failed to apply heater change", "heaterID", heaterID, "error", err)
-			}
-			if wasApplied {
-				applied = true
+		// Boost demandé (ou durée modifiée pendant un boost) : Confort temporaire puis retour à l'état précédent
+		if heaterState.PresetMode == state.HeaterPresetModeBoost && heaterState.Mode != state.HeaterModeOff && !heaterChanges.Has(state.FieldMode) {
+			b.regulator.intercept(heaterID, heaterState, heaterChanges)
+			if err := b.applyBoost(heaterID, b.boostDuration(heaterState.Duration), appliances); err != nil {
+				b.failCommand(heaterID, mqtt.EventCommandFailed, err)
+				rollback = append(rollback, heaterID)
+				continue
 			}
+			refresh = append(refresh, heaterID)
+			continue
+		}
+
+		// Une commande explicite de l'utilisateur prime sur un forçage en cours : l'état capturé n'est plus restauré
+		if b.overrides.remove(heaterID) {
+			slog.Info("Forçage annulé par une commande HA", "heaterID", heaterID)
+		}
+
+		// Les radiateurs régulés par une sonde de pièce ne reçoivent pas directement la consigne
+		if b.regulator.intercept(heaterID, heaterState, heaterChanges) {
+			b.regulateHeater(heaterID, manualSettings, appliances)
+			refresh = append(refresh, heaterID)
+			continue
 		}
+
+		// Pour les changements individuels de radiateurs, on utilise manualsetting
+		applied, err := handleSingleHeaterChange(apiClient, b.opts.Heater(int(heaterID)), heaterState, heaterChanges, manualSettings, appliances)
+		if err != nil {
+			b.failCommand(heaterID, mqtt.EventCommandFailed, err)
+			rollback = append(rollback, heaterID)
+			continue
+		}
+		if !applied {
+			// Aucune écriture (durée seule, radiateur déjà sur sa programmation...) : rien à confirmer côté Voltalis
+			b.pending.remove(heaterID)
+			continue
+		}
+		refresh = append(refresh, heaterID)
 	}
 
-	return applied, nil
+	return refresh, rollback
 }
 
 // handleSingleHeaterChange traite le changement d'un seul radiateur
 // Retourne true si des changements ont été appliqués côté Voltalis
-func handleSingleHeaterChange(apiClient *api.Client, heaterID int, heaterState state.HeaterState, changes map[string]interface{}, manualSettings []api.ManualSetting, appliances []api.Appliance) (bool, error) {
+func handleSingleHeaterChange(apiClient voltalisClient, heater config.HeaterOptions, heaterState state.HeaterState, changes state.Fields, manualSettings []api.ManualSetting, appliances []api.Appliance) (bool, error) {
+	heaterID := heater.ApplianceID
 	slog.Debug("Changement individuel de radiateur détecté",
 		"heaterID", heaterID,
 		"presetMode", heaterState.PresetMode,
@@ -368,8 +498,8 @@ func handleSingleHeaterChange(apiClient *api.Client, heaterID int, heaterState s
 	}
 
 	// Vérifier si c'est un changement de preset (important: à vérifier AVANT le mode auto)
-	_, hasPresetChange := changes["PresetMode"]
-	_, hasModeChange := changes["Mode"]
+	hasPresetChange := changes.Has(state.FieldPresetMode)
+	hasModeChange := changes.Has(state.FieldMode)
 
 	slog.Debug("Analyse des changements",
 		"hasPresetChange", hasPresetChange,
@@ -388,15 +518,7 @@ func handleSingleHeaterChange(apiClient *api.Client, heaterID int, heaterState s
 					"manualSettingID", existingMS.ID,
 					"heaterID", heaterID,
 				)
-				request := api.UpdateManualSettingRequest{
-					Enabled:            false,
-					IDAppliance:        heaterID,
-					UntilFurtherNotice: true,
-					IsOn:               false,
-					Mode:               existingMS.Mode,
-					TemperatureTarget:  existingMS.TemperatureTarget,
-				}
-				if err := apiClient.UpdateManualSetting(existingMS.ID, request); err != nil {
+				if err := disableManualSetting(apiClient, existingMS); err != nil {
 					return false, err
 				}
 				slog.Info("ManualSetting désactivé, retour à la programmation", "heaterID", heaterID)
@@ -453,18 +575,8 @@ func handleSingleHeaterChange(apiClient *api.Client, heaterID int, heaterState s
 	var voltalisMode string
 	var modeExists bool
 
-	// Récupérer la nouvelle valeur du preset si elle a changé
+	// L'état reçu porte déjà la nouvelle valeur du preset
 	presetMode := heaterState.PresetMode
-	if hasPresetChange {
-		// Si le preset a changé, utiliser la nouvelle valeur du changement
-		if newPreset, ok := changes["PresetMode"].(state.HeaterPresetMode); ok {
-			presetMode = newPreset
-			slog.Debug("Utilisation du nouveau preset depuis le changement", "preset", presetMode)
-		} else if newPresetStr, ok := changes["PresetMode"].(string); ok {
-			presetMode = state.HeaterPresetMode(newPresetStr)
-			slog.Debug("Utilisation du nouveau preset depuis le changement (string)", "preset", presetMode)
-		}
-	}
 
 	// Cas 1: Mode "heat" SANS changement de preset = température manuelle
 	if heaterState.Mode == state.HeaterModeHeat && !hasPresetChange {
@@ -483,7 +595,7 @@ func handleSingleHeaterChange(apiClient *api.Client, heaterID int, heaterState s
 		// Ignorer les changements qui ne correspondent pas à un mode Voltalis valide
 		// Par exemple: changement de durée sans changement de mode
 		// On vérifie si c'est juste un changement de durée
-		if _, hasDuration := changes["Duration"]; hasDuration && len(changes) == 1 {
+		if changes.Only(state.FieldDuration) {
 			slog.Debug("Changement de durée uniquement, pas d'action nécessaire", "heaterID", heaterID)
 			return false, nil
 		}
@@ -492,24 +604,24 @@ func handleSingleHeaterChange(apiClient *api.Client, heaterID int, heaterState s
 	}
 
 	// Calculer untilFurtherNotice et endDate
-	untilFurtherNotice := true
-	var endDate *string
-
-	if heaterState.Duration != "" && heaterState.Duration != "Jusqu'à ce que je change d'avis" {
-		untilFurtherNotice = false
-		parsedDuration := parseDuration(heaterState.Duration)
-		if parsedDuration > 0 {
-			end := time.Now().Add(parsedDuration).Format("2006-01-02T15:04:05")
-			endDate = &end
-		}
+	untilFurtherNotice, endDate, err := endDateFromDuration(apiClient, heaterState.Duration)
+	if err != nil {
+		return false, err
 	}
 
 	// Déterminer la température cible
-	// Pour le mode TEMPERATURE, utiliser la température de l'état HA
+	// Pour le mode TEMPERATURE, utiliser la température de l'état HA, à défaut la dernière consigne manuelle
 	// Pour les autres modes (CONFORT, ECO, HORS_GEL), utiliser la température par défaut
+	// Seules les consignes venant de HA sont ramenées dans la plage du radiateur : les températures des presets
+	// sont envoyées telles que configurées (vérifiées au démarrage par checkPresetTemperatures)
 	tempTarget := appliance.Programming.DefaultTemperature
 	if voltalisMode == "TEMPERATURE" && heaterState.Temperature > 0 {
-		tempTarget = heaterState.Temperature
+		tempTarget = temperatureLimits(*appliance, heater).Normalize(heaterState.Temperature)
+	} else if voltalisMode == "TEMPERATURE" && heaterState.LastTemperature > 0 {
+		tempTarget = temperatureLimits(*appliance, heater).Normalize(heaterState.LastTemperature)
+	} else if voltalisMode != "TEMPERATURE" {
+		// Preset avec une température configurée : envoyé comme consigne TEMPERATURE
+		voltalisMode, tempTarget = withPresetTemperature(heater, voltalisMode, tempTarget)
 	}
 
 	// Construire la requête
@@ -555,19 +667,18 @@ func handleSingleHeaterChange(apiClient *api.Client, heaterID int, heaterState s
 	return true, nil
 }
 
-// parseDuration convertit une chaîne de durée en time.Duration
-func parseDuration(durationStr string) time.Duration {
-	// Mapping basé sur les valeurs définies dans mqtt/enums.go
-	durationMap := map[string]time.Duration{
-		"Pendant 1 heure":  1 * time.Hour,
-		"Pendant 2 heures": 2 * time.Hour,
-		"Pendant 3 heures": 3 * time.Hour,
-		"Pendant 4 heures": 4 * time.Hour,
+// endDateFromDuration calcule untilFurtherNotice et la date de fin Voltalis correspondant à une durée choisie dans HA
+// (option du select, durée personnalisée ou date de fin absolue)
+// Une date de fin déjà passée est refusée plutôt que d'être envoyée comme "jusqu'à nouvel ordre"
+func endDateFromDuration(apiClient voltalisClient, duration string) (bool, *string, error) {
+	end, err := mqtt.ParseEndDate(duration, time.Now())
+	if err != nil {
+		return false, nil, err
 	}
-
-	if d, ok := durationMap[durationStr]; ok {
-		return d
+	if end == nil {
+		return true, nil, nil
 	}
-
-	return 0
+	// Format sans timezone, dans l'heure locale du site, comme attendu par l'API Voltalis
+	formatted := apiClient.FormatDate(*end)
+	return false, &formatted, nil
 }
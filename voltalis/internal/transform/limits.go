@@ -0,0 +1,57 @@
+package transform
+
+import (
+	"log/slog"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/config"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+)
+
+// temperatureTolerance absorbe les arrondis de Voltalis lors de la comparaison des consignes
+const temperatureTolerance = 0.05
+
+// temperatureLimits détermine la plage de consigne d'un radiateur : options de l'add-on, et à défaut la plage standard.
+// L'API Voltalis n'expose pas de plage par radiateur
+func temperatureLimits(appliance api.Appliance, heater config.HeaterOptions) mqtt.TemperatureLimits {
+	limits := mqtt.TemperatureLimits{
+		Min:  firstPositive(heater.MinTemperature, mqtt.DEFAULT_TEMPERATURE_LIMITS.Min),
+		Max:  firstPositive(heater.MaxTemperature, mqtt.DEFAULT_TEMPERATURE_LIMITS.Max),
+		Step: firstPositive(heater.TemperatureStep, mqtt.DEFAULT_TEMPERATURE_LIMITS.Step),
+	}
+	if !limits.Valid() {
+		slog.Warn("Plage de consigne incohérente, plage par défaut utilisée", "heaterID", appliance.ID, "min", limits.Min, "max", limits.Max, "step", limits.Step)
+		return mqtt.DEFAULT_TEMPERATURE_LIMITS
+	}
+	return limits
+}
+
+// checkPresetTemperatures signale les températures de presets configurées hors de la plage de consigne du radiateur.
+// Elles sont envoyées telles quelles : la plage ne s'applique qu'aux consignes saisies dans HA
+func checkPresetTemperatures(appliance api.Appliance, heater config.HeaterOptions) {
+	limits := temperatureLimits(appliance, heater)
+	for _, preset := range presetTemperatures(heater) {
+		if preset.temperature > 0 && (preset.temperature < limits.Min || preset.temperature > limits.Max) {
+			slog.Warn("Température de preset hors de la plage de consigne du radiateur",
+				"heaterID", appliance.ID, "preset", preset.preset, "temperature", preset.temperature, "min", limits.Min, "max", limits.Max)
+		}
+	}
+}
+
+// heaterSettings construit les réglages de déclaration d'un radiateur dans HA
+func heaterSettings(appliance api.Appliance, heater config.HeaterOptions) mqtt.HeaterSettings {
+	return mqtt.HeaterSettings{
+		DefaultTemperature: heater.DefaultTemperature,
+		Limits:             temperatureLimits(appliance, heater),
+	}
+}
+
+// firstPositive retourne la première valeur strictement positive
+func firstPositive(values ...float64) float64 {
+	for _, value := range values {
+		if value > 0 {
+			return value
+		}
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+package transform
+
+import (
+	"log/slog"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+)
+
+// dryRunTopic reçoit les requêtes qui auraient été envoyées à Voltalis en mode simulation
+const dryRunTopic mqtt.GetTopic = "voltalis/debug/dry_run"
+
+// readOnlyClient refuse toute écriture vers Voltalis : l'add-on se contente de refléter l'état des radiateurs
+type readOnlyClient struct {
+	voltalisClient
+}
+
+func (c readOnlyClient) CreateManualSetting(request api.UpdateManualSettingRequest) (*api.ManualSetting, error) {
+	return nil, mqtt.ErrReadOnly
+}
+
+func (c readOnlyClient) UpdateManualSetting(manualSettingID int, request api.UpdateManualSettingRequest) error {
+	return mqtt.ErrReadOnly
+}
+
+func (c readOnlyClient) UpdateQuickSettings(qsID int, qs api.QuickSettings) error {
+	return mqtt.ErrReadOnly
+}
+
+func (c readOnlyClient) EnableQuickSetting(qsID int, enabled bool) error {
+	return mqtt.ErrReadOnly
+}
+
+func (c readOnlyClient) UpdateProgram(programID int, request api.UpdateProgramRequest) error {
+	return mqtt.ErrReadOnly
+}
+
+// dryRunClient simule les écritures vers Voltalis : chaque requête est journalisée et publiée
+// sur dryRunTopic au lieu d'être envoyée. Les lectures interrogent toujours Voltalis
+type dryRunClient struct {
+	voltalisClient
+	mqttClient *mqtt.Client
+}
+
+func (c dryRunClient) CreateManualSetting(request api.UpdateManualSettingRequest) (*api.ManualSetting, error) {
+	c.simulate("CreateManualSetting", 0, request)
+	return &api.ManualSetting{
+		Enabled:            request.Enabled,
+		IDAppliance:        request.IDAppliance,
+		UntilFurtherNotice: request.UntilFurtherNotice,
+		IsOn:               request.IsOn,
+		Mode:               request.Mode,
+		EndDate:            request.EndDate,
+		TemperatureTarget:  request.TemperatureTarget,
+	}, nil
+}
+
+func (c dryRunClient) UpdateManualSetting(manualSettingID int, request api.UpdateManualSettingRequest) error {
+	c.simulate("UpdateManualSetting", manualSettingID, request)
+	return nil
+}
+
+func (c dryRunClient) UpdateQuickSettings(qsID int, qs api.QuickSettings) error {
+	c.simulate("UpdateQuickSettings", qsID, qs)
+	return nil
+}
+
+func (c dryRunClient) EnableQuickSetting(qsID int, enabled bool) error {
+	c.simulate("EnableQuickSetting", qsID, api.EnableRequest{Enabled: enabled})
+	return nil
+}
+
+func (c dryRunClient) UpdateProgram(programID int, request api.UpdateProgramRequest) error {
+	c.simulate("UpdateProgram", programID, request)
+	return nil
+}
+
+// simulate journalise et publie une requête non envoyée
+func (c dryRunClient) simulate(method string, id int, request any) {
+	slog.Info("Simulation : requête non envoyée à Voltalis", "method", method, "id", id, "request", request)
+	c.mqttClient.PublishState(dryRunTopic, map[string]any{
+		"method":  method,
+		"id":      id,
+		"request": request,
+	})
+}
@@ -0,0 +1,218 @@
+package transform
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/store"
+)
+
+// overrideReason identifie l'origine d'un forçage temporaire d'un radiateur
+type overrideReason string
+
+const (
+	overrideWindow overrideReason = "window"
+	overrideBoost  overrideReason = "boost"
+)
+
+// previousState est l'état d'un radiateur capturé avant un forçage, pour pouvoir le restaurer exactement
+type previousState struct {
+	ProgType string `json:"progType"`
+	// ManualSetting est le réglage manuel actif avant le forçage (nil si le radiateur suivait un programme ou un quicksetting)
+	ManualSetting *api.ManualSetting `json:"manualSetting,omitempty"`
+}
+
+type override struct {
+	Reason   overrideReason `json:"reason"`
+	Since    time.Time      `json:"since"`
+	Until    time.Time      `json:"until,omitempty"`
+	Previous previousState  `json:"previous"`
+}
+
+const (
+	overridesName = "overrides"
+	// overridesSchemaVersion est à incrémenter à chaque changement incompatible de override
+	overridesSchemaVersion = 1
+)
+
+// overrides mémorise les forçages en cours. Ils sont persistés pour survivre aux redémarrages de l'add-on
+type overrides struct {
+	mu      sync.Mutex
+	store   *store.Store
+	heaters map[int64]override
+}
+
+func loadOverrides(st *store.Store) *overrides {
+	o := &overrides{store: st, heaters: make(map[int64]override)}
+	if st == nil {
+		return o
+	}
+	if _, err := st.LoadVersioned(overridesName, overridesSchemaVersion, &o.heaters); err != nil {
+		slog.Error("failed to load overrides", "error", err)
+	}
+	return o
+}
+
+func (o *overrides) get(id int64) (override, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	ov, ok := o.heaters[id]
+	return ov, ok
+}
+
+// ids retourne les radiateurs forcés pour la raison donnée
+func (o *overrides) ids(reason overrideReason) []int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var ids []int64
+	for id, ov := range o.heaters {
+		if ov.Reason == reason {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (o *overrides) set(id int64, ov override) {
+	o.mu.Lock()
+	o.heaters[id] = ov
+	o.mu.Unlock()
+	o.save()
+}
+
+// remove supprime le forçage d'un radiateur. Retourne false s'il n'y en avait pas
+func (o *overrides) remove(id int64) bool {
+	o.mu.Lock()
+	_, ok := o.heaters[id]
+	delete(o.heaters, id)
+	o.mu.Unlock()
+	if ok {
+		o.save()
+	}
+	return ok
+}
+
+func (o *overrides) save() {
+	if o.store == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.store.SaveVersioned(overridesName, overridesSchemaVersion, o.heaters); err != nil {
+		slog.Error("failed to save overrides", "error", err)
+	}
+}
+
+// applyOverride force un réglage manuel temporaire sur un radiateur en mémorisant l'état précédent.
+// Si le radiateur est déjà forcé, l'état d'origine capturé lors du premier forçage est conservé.
+// La fenêtre est prioritaire : elle remplace un boost en cours, un boost est refusé pendant son ouverture (applyBoost)
+func (b *Bridge) applyOverride(id int64, reason overrideReason, until time.Time, request api.UpdateManualSettingRequest) error {
+	manualSettings, err := b.apiClient.GetManualSettings()
+	if err != nil {
+		return err
+	}
+	existingMS := findManualSetting(manualSettings, int(id))
+
+	current, alreadyForced := b.overrides.get(id)
+	previous := current.Previous
+	if !alreadyForced {
+		appliance, err := b.apiClient.GetAppliance(int(id))
+		if err != nil {
+			return err
+		}
+		previous = previousState{ProgType: appliance.Programming.ProgType}
+		if appliance.Programming.ProgType == "MANUAL" && existingMS != nil && existingMS.Enabled {
+			snapshot := *existingMS
+			previous.ManualSetting = &snapshot
+		}
+	}
+
+	if err := upsertManualSetting(b.apiClient, existingMS, request); err != nil {
+		return err
+	}
+	b.overrides.set(id, override{Reason: reason, Since: time.Now(), Until: until, Previous: previous})
+	slog.Info("Radiateur forcé", "heaterID", id, "reason", reason, "mode", request.Mode, "previousProgType", previous.ProgType)
+	return nil
+}
+
+// restoreOverride restaure l'état capturé avant le forçage (réglage manuel, programme ou quicksetting)
+// Retourne true si une écriture a été faite côté Voltalis
+func (b *Bridge) restoreOverride(id int64, reason overrideReason) (bool, error) {
+	ov, ok := b.overrides.get(id)
+	if !ok || ov.Reason != reason {
+		return false, nil
+	}
+	manualSettings, err := b.apiClient.GetManualSettings()
+	if err != nil {
+		return false, err
+	}
+	existingMS := findManualSetting(manualSettings, int(id))
+
+	previous := ov.Previous.ManualSetting
+	if previous != nil && !endDatePassed(b.apiClient, previous.EndDate) {
+		// Un réglage manuel était actif : on le réapplique à l'identique
+		request := api.UpdateManualSettingRequest{
+			Enabled:            true,
+			IDAppliance:        int(id),
+			UntilFurtherNotice: previous.UntilFurtherNotice,
+			IsOn:               previous.IsOn,
+			Mode:               previous.Mode,
+			EndDate:            previous.EndDate,
+			TemperatureTarget:  previous.TemperatureTarget,
+		}
+		if err := upsertManualSetting(b.apiClient, existingMS, request); err != nil {
+			return false, err
+		}
+	} else if existingMS != nil && existingMS.Enabled {
+		// Le radiateur suivait un programme ou un quicksetting : désactiver le forçage suffit à y revenir
+		if err := disableManualSetting(b.apiClient, existingMS); err != nil {
+			return false, err
+		}
+	}
+	b.overrides.remove(id)
+	// L'état restauré remplace la dernière demande HA (le boost notamment ne doit pas être réappliqué)
+	b.mqttClient.StateManager.ClearIntent(id)
+	slog.Info("État du radiateur restauré", "heaterID", id, "reason", reason, "progType", ov.Previous.ProgType)
+	return true, nil
+}
+
+func findManualSetting(manualSettings []api.ManualSetting, heaterID int) *api.ManualSetting {
+	for _, ms := range manualSettings {
+		if ms.IDAppliance == heaterID {
+			return &ms
+		}
+	}
+	return nil
+}
+
+// upsertManualSetting met à jour le réglage manuel existant du radiateur, ou en crée un
+func upsertManualSetting(apiClient voltalisClient, existingMS *api.ManualSetting, request api.UpdateManualSettingRequest) error {
+	if existingMS != nil {
+		return apiClient.UpdateManualSetting(existingMS.ID, request)
+	}
+	_, err := apiClient.CreateManualSetting(request)
+	return err
+}
+
+// endDatePassed indique si une date de fin Voltalis est dépassée (false si pas de date de fin)
+func endDatePassed(apiClient voltalisClient, endDate *string) bool {
+	end := parseEndDate(apiClient, endDate)
+	return end != nil && time.Now().After(*end)
+}
+
+// parseEndDate interprète une date de fin Voltalis dans le fuseau du site (nil si absente ou invalide)
+func parseEndDate(apiClient voltalisClient, endDate *string) *time.Time {
+	if endDate == nil {
+		return nil
+	}
+	end, err := apiClient.ParseDate(*endDate)
+	if err != nil {
+		slog.Warn("date de fin Voltalis invalide", "endDate", *endDate, "error", err)
+		return nil
+	}
+	return &end
+}
@@ -0,0 +1,82 @@
+package transform
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+)
+
+// Au-delà de ce délai après l'envoi, une commande non confirmée n'est plus considérée comme en attente.
+// La fenêtre de debounce, pendant laquelle la commande n'est pas encore envoyée, s'y ajoute
+const pendingTimeout = refreshDelay*refreshAttempts + 10*time.Second
+
+// pendingCommand est l'état demandé par HA pour un radiateur, affiché de façon optimiste
+// tant que Voltalis ne l'a pas confirmé
+type pendingCommand struct {
+	expected    state.HeaterState
+	checkPreset bool
+	since       time.Time
+}
+
+// matches indique si l'état relu depuis Voltalis correspond à l'état demandé
+func (c pendingCommand) matches(actual state.HeaterState) bool {
+	if actual.Mode != c.expected.Mode {
+		return false
+	}
+	switch c.expected.Mode {
+	case state.HeaterModeOff:
+		return true
+	case state.HeaterModeHeat:
+		return math.Abs(actual.Temperature-c.expected.Temperature) < temperatureTolerance
+	default:
+		return !c.checkPreset || actual.PresetMode == c.expected.PresetMode
+	}
+}
+
+// pendingCommands suit les commandes HA envoyées à Voltalis et pas encore confirmées
+type pendingCommands struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	heaters map[int64]pendingCommand
+}
+
+func newPendingCommands(debounce time.Duration) *pendingCommands {
+	return &pendingCommands{timeout: pendingTimeout + debounce, heaters: make(map[int64]pendingCommand)}
+}
+
+func (p *pendingCommands) add(id int64, expected state.HeaterState, changes state.Fields) {
+	p.mu.Lock()
+	p.heaters[id] = pendingCommand{expected: expected, checkPreset: changes.Has(state.FieldPresetMode), since: time.Now()}
+	p.mu.Unlock()
+}
+
+// get retourne la commande en attente d'un radiateur (les commandes trop anciennes sont ignorées)
+func (p *pendingCommands) get(id int64) (pendingCommand, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cmd, ok := p.heaters[id]
+	if ok && time.Since(cmd.since) > p.timeout {
+		delete(p.heaters, id)
+		return pendingCommand{}, false
+	}
+	return cmd, ok
+}
+
+func (p *pendingCommands) remove(id int64) {
+	p.mu.Lock()
+	delete(p.heaters, id)
+	p.mu.Unlock()
+}
+
+// failCommand abandonne la commande en attente d'un radiateur et le signale dans HA.
+// L'état réel doit ensuite être republié pour annuler l'affichage optimiste
+func (b *Bridge) failCommand(id int64, eventType string, err error) {
+	b.pending.remove(id)
+	slog.Error("commande non appliquée, retour à l'état Voltalis", "heaterID", id, "event", eventType, "error", err)
+	b.mqttClient.PublishEvent(b.mqttClient.BuildHeaterStateTopic(id).Errors, eventType, map[string]any{
+		"message": err.Error(),
+	})
+}
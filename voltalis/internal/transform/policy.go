@@ -0,0 +1,232 @@
+package transform
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/config"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+)
+
+// errPolicyBlocked est renvoyée pour une écriture refusée par une règle de sécurité
+var errPolicyBlocked = errors.New("commande bloquée par une règle de sécurité")
+
+const (
+	policyAdjusted = "adjusted"
+	policyBlocked  = "blocked"
+)
+
+// violation décrit une commande ajustée ou bloquée par une règle de sécurité
+type violation struct {
+	policy      string
+	applianceID int // 0 pour une commande globale (programme)
+	action      string
+	reason      string
+}
+
+// policyClient applique les règles de sécurité à chaque écriture avant de la transmettre à Voltalis.
+// Les lectures sont transmises telles quelles
+type policyClient struct {
+	voltalisClient
+	rules  []config.PolicyOptions
+	report func(violation)
+}
+
+func newPolicyClient(client voltalisClient, rules []config.PolicyOptions, report func(violation)) voltalisClient {
+	if len(rules) == 0 {
+		return client
+	}
+	return &policyClient{voltalisClient: client, rules: rules, report: report}
+}
+
+func (c *policyClient) CreateManualSetting(request api.UpdateManualSettingRequest) (*api.ManualSetting, error) {
+	if err := c.checkManualSetting(&request); err != nil {
+		return nil, err
+	}
+	return c.voltalisClient.CreateManualSetting(request)
+}
+
+func (c *policyClient) UpdateManualSetting(manualSettingID int, request api.UpdateManualSettingRequest) error {
+	if err := c.checkManualSetting(&request); err != nil {
+		return err
+	}
+	return c.voltalisClient.UpdateManualSetting(manualSettingID, request)
+}
+
+func (c *policyClient) UpdateQuickSettings(qsID int, qs api.QuickSettings) error {
+	settings := slices.Clone(qs.AppliancesSettings)
+	for i := range settings {
+		setting := &settings[i]
+		if err := c.checkSetting(setting.IDAppliance, setting.IsOn, &setting.Mode, &setting.TemperatureTarget); err != nil {
+			return err
+		}
+	}
+	qs.AppliancesSettings = settings
+	return c.voltalisClient.UpdateQuickSettings(qsID, qs)
+}
+
+// EnableQuickSetting contrôle les réglages enregistrés dans le quicksetting avant de l'activer :
+// un réglage bloqué refuse l'activation, un réglage ajusté est réécrit avant l'activation
+func (c *policyClient) EnableQuickSetting(qsID int, enabled bool) error {
+	if !enabled {
+		return c.voltalisClient.EnableQuickSetting(qsID, enabled)
+	}
+	quickSettings, err := c.voltalisClient.GetQuickSettings()
+	if err != nil {
+		return fmt.Errorf("failed to get quicksettings: %w", err)
+	}
+	for _, qs := range quickSettings {
+		if qs.ID != qsID {
+			continue
+		}
+		settings := slices.Clone(qs.AppliancesSettings)
+		for i := range settings {
+			setting := &settings[i]
+			if err := c.checkSetting(setting.IDAppliance, setting.IsOn, &setting.Mode, &setting.TemperatureTarget); err != nil {
+				return err
+			}
+		}
+		if !slices.Equal(settings, qs.AppliancesSettings) {
+			qs.AppliancesSettings = settings
+			qs.Enabled = false
+			if err := c.voltalisClient.UpdateQuickSettings(qsID, qs); err != nil {
+				return err
+			}
+		}
+	}
+	return c.voltalisClient.EnableQuickSetting(qsID, enabled)
+}
+
+func (c *policyClient) UpdateProgram(programID int, request api.UpdateProgramRequest) error {
+	if request.Enabled {
+		if err := c.checkProgram(request.Name); err != nil {
+			return err
+		}
+	}
+	return c.voltalisClient.UpdateProgram(programID, request)
+}
+
+// programPolicy permet de refuser l'activation d'un programme interdit avant toute écriture,
+// le changement de programme désactivant d'abord le programme en cours
+type programPolicy interface {
+	checkProgram(name string) error
+}
+
+// checkProgram renvoie une erreur si l'activation du programme est interdite
+func (c *policyClient) checkProgram(name string) error {
+	for _, rule := range c.rules {
+		if slices.Contains(splitList(rule.ForbiddenPrograms), name) {
+			return c.block(rule, 0, fmt.Sprintf("programme %q interdit", name))
+		}
+	}
+	return nil
+}
+
+// checkManualSetting évalue un réglage manuel. Sa désactivation (retour à la programmation) n'est pas contrôlée
+func (c *policyClient) checkManualSetting(request *api.UpdateManualSettingRequest) error {
+	if !request.Enabled {
+		return nil
+	}
+	return c.checkSetting(request.IDAppliance, request.IsOn, &request.Mode, &request.TemperatureTarget)
+}
+
+// checkSetting évalue le réglage d'un radiateur : le mode et la consigne sont ajustés sur place,
+// une erreur est renvoyée si le réglage est bloqué
+func (c *policyClient) checkSetting(applianceID int, isOn bool, mode *string, temperatureTarget *float64) error {
+	for _, rule := range c.rules {
+		if rule.ApplianceID != 0 && rule.ApplianceID != applianceID {
+			continue
+		}
+		if !isOn {
+			if rule.ForbidOff {
+				return c.block(rule, applianceID, "extinction interdite")
+			}
+			continue
+		}
+		if slices.Contains(splitList(rule.ForbiddenModes), *mode) {
+			return c.block(rule, applianceID, fmt.Sprintf("mode %s interdit", *mode))
+		}
+		if bound, ok := presetBound(rule, *mode); ok {
+			if rule.Action == "block" {
+				return c.block(rule, applianceID, fmt.Sprintf("preset %s sans garantie de consigne dans les bornes autorisées", *mode))
+			}
+			reason := fmt.Sprintf("preset %s sans garantie de consigne dans les bornes autorisées, remplacé par %.1f°C", *mode, bound)
+			*mode, *temperatureTarget = "TEMPERATURE", bound
+			c.report(violation{policy: rule.Name, applianceID: applianceID, action: policyAdjusted, reason: reason})
+			continue
+		}
+		if *mode != "TEMPERATURE" {
+			continue
+		}
+		target := *temperatureTarget
+		if rule.MinTemperature > 0 && target < rule.MinTemperature {
+			target = rule.MinTemperature
+		}
+		if rule.MaxTemperature > 0 && target > rule.MaxTemperature {
+			target = rule.MaxTemperature
+		}
+		if target == *temperatureTarget {
+			continue
+		}
+		reason := fmt.Sprintf("consigne %.1f°C hors des bornes autorisées, ramenée à %.1f°C", *temperatureTarget, target)
+		if rule.Action == "block" {
+			return c.block(rule, applianceID, fmt.Sprintf("consigne %.1f°C hors des bornes autorisées", *temperatureTarget))
+		}
+		*temperatureTarget = target
+		c.report(violation{policy: rule.Name, applianceID: applianceID, action: policyAdjusted, reason: reason})
+	}
+	return nil
+}
+
+// presetBound retourne la borne à appliquer à un preset Voltalis. Les consignes internes des presets sont inconnues :
+// Eco et Hors-Gel peuvent passer sous un minimum, Confort dépasser un maximum
+func presetBound(rule config.PolicyOptions, mode string) (float64, bool) {
+	switch {
+	case rule.MinTemperature > 0 && (mode == "ECO" || mode == "HORS_GEL"):
+		return rule.MinTemperature, true
+	case rule.MaxTemperature > 0 && mode == "CONFORT":
+		return rule.MaxTemperature, true
+	}
+	return 0, false
+}
+
+// block signale une commande bloquée et retourne l'erreur à remonter à l'appelant
+func (c *policyClient) block(rule config.PolicyOptions, applianceID int, reason string) error {
+	c.report(violation{policy: rule.Name, applianceID: applianceID, action: policyBlocked, reason: reason})
+	return fmt.Errorf("%w (%s): %s", errPolicyBlocked, rule.Name, reason)
+}
+
+// reportViolation journalise une violation de règle et la signale sur l'entité "Erreurs" du radiateur ou du contrôleur
+func (b *Bridge) reportViolation(v violation) {
+	slog.Warn("Règle de sécurité appliquée", "policy", v.policy, "heaterID", v.applianceID, "action", v.action, "reason", v.reason)
+	topic := b.mqttClient.BuildControllerStateTopic().Errors
+	if v.applianceID != 0 {
+		id := int64(v.applianceID)
+		topic = b.mqttClient.BuildHeaterStateTopic(id).Errors
+		if v.action == policyAdjusted {
+			// Voltalis appliquera la consigne ajustée et non celle demandée par HA :
+			// la relecture attend un simple changement de programmation
+			b.pending.remove(id)
+		}
+	}
+	b.mqttClient.PublishEvent(topic, mqtt.EventPolicyViolation, map[string]any{
+		"policy":  v.policy,
+		"action":  v.action,
+		"message": v.reason,
+	})
+}
+
+// splitList découpe une liste d'options séparées par des virgules
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,242 @@
+package transform
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/config"
+)
+
+// fakeClient enregistre les écritures transmises par le policyClient
+type fakeClient struct {
+	voltalisClient
+	quickSettings  []api.QuickSettings
+	manualSettings []api.UpdateManualSettingRequest
+	updatedQS      []api.QuickSettings
+	enabledQS      []int
+	programs       []api.UpdateProgramRequest
+}
+
+func (f *fakeClient) GetQuickSettings() ([]api.QuickSettings, error) {
+	return f.quickSettings, nil
+}
+
+func (f *fakeClient) CreateManualSetting(request api.UpdateManualSettingRequest) (*api.ManualSetting, error) {
+	f.manualSettings = append(f.manualSettings, request)
+	return &api.ManualSetting{}, nil
+}
+
+func (f *fakeClient) UpdateQuickSettings(qsID int, qs api.QuickSettings) error {
+	f.updatedQS = append(f.updatedQS, qs)
+	return nil
+}
+
+func (f *fakeClient) EnableQuickSetting(qsID int, enabled bool) error {
+	if enabled {
+		f.enabledQS = append(f.enabledQS, qsID)
+	}
+	return nil
+}
+
+func (f *fakeClient) UpdateProgram(programID int, request api.UpdateProgramRequest) error {
+	f.programs = append(f.programs, request)
+	return nil
+}
+
+func newTestPolicyClient(rules ...config.PolicyOptions) (*fakeClient, voltalisClient, *[]violation) {
+	fake := &fakeClient{}
+	var violations []violation
+	client := newPolicyClient(fake, rules, func(v violation) { violations = append(violations, v) })
+	return fake, client, &violations
+}
+
+func TestPolicyManualSetting(t *testing.T) {
+	bounds := config.PolicyOptions{Name: "bornes", MinTemperature: 16, MaxTemperature: 21}
+	tests := []struct {
+		name     string
+		rule     config.PolicyOptions
+		request  api.UpdateManualSettingRequest
+		blocked  bool
+		wantMode string
+		wantTemp float64
+	}{
+		{
+			name:     "consigne ramenée au maximum",
+			rule:     bounds,
+			request:  api.UpdateManualSettingRequest{Enabled: true, IDAppliance: 1, IsOn: true, Mode: "TEMPERATURE", TemperatureTarget: 24},
+			wantMode: "TEMPERATURE",
+			wantTemp: 21,
+		},
+		{
+			name:     "consigne dans les bornes inchangée",
+			rule:     bounds,
+			request:  api.UpdateManualSettingRequest{Enabled: true, IDAppliance: 1, IsOn: true, Mode: "TEMPERATURE", TemperatureTarget: 19},
+			wantMode: "TEMPERATURE",
+			wantTemp: 19,
+		},
+		{
+			name:    "consigne hors bornes bloquée",
+			rule:    config.PolicyOptions{Name: "bornes", MinTemperature: 16, Action: "block"},
+			request: api.UpdateManualSettingRequest{Enabled: true, IDAppliance: 1, IsOn: true, Mode: "TEMPERATURE", TemperatureTarget: 12},
+			blocked: true,
+		},
+		{
+			name:     "preset Eco remplacé par le minimum",
+			rule:     bounds,
+			request:  api.UpdateManualSettingRequest{Enabled: true, IDAppliance: 1, IsOn: true, Mode: "ECO"},
+			wantMode: "TEMPERATURE",
+			wantTemp: 16,
+		},
+		{
+			name:     "preset Confort remplacé par le maximum",
+			rule:     bounds,
+			request:  api.UpdateManualSettingRequest{Enabled: true, IDAppliance: 1, IsOn: true, Mode: "CONFORT"},
+			wantMode: "TEMPERATURE",
+			wantTemp: 21,
+		},
+		{
+			name:    "preset Hors-Gel bloqué",
+			rule:    config.PolicyOptions{Name: "bornes", MinTemperature: 16, Action: "block"},
+			request: api.UpdateManualSettingRequest{Enabled: true, IDAppliance: 1, IsOn: true, Mode: "HORS_GEL"},
+			blocked: true,
+		},
+		{
+			name:    "extinction interdite",
+			rule:    config.PolicyOptions{Name: "marche", ForbidOff: true},
+			request: api.UpdateManualSettingRequest{Enabled: true, IDAppliance: 1, IsOn: false, Mode: "TEMPERATURE", TemperatureTarget: 19},
+			blocked: true,
+		},
+		{
+			name:    "mode interdit",
+			rule:    config.PolicyOptions{Name: "modes", ForbiddenModes: "ECO, HORS_GEL"},
+			request: api.UpdateManualSettingRequest{Enabled: true, IDAppliance: 1, IsOn: true, Mode: "ECO"},
+			blocked: true,
+		},
+		{
+			name:     "règle d'un autre radiateur ignorée",
+			rule:     config.PolicyOptions{Name: "marche", ApplianceID: 2, ForbidOff: true},
+			request:  api.UpdateManualSettingRequest{Enabled: true, IDAppliance: 1, IsOn: false, Mode: "TEMPERATURE", TemperatureTarget: 19},
+			wantMode: "TEMPERATURE",
+			wantTemp: 19,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, client, violations := newTestPolicyClient(tt.rule)
+			_, err := client.CreateManualSetting(tt.request)
+			if tt.blocked {
+				if !errors.Is(err, errPolicyBlocked) {
+					t.Fatalf("erreur = %v, attendu un blocage", err)
+				}
+				if len(fake.manualSettings) != 0 {
+					t.Errorf("réglage bloqué transmis à Voltalis: %+v", fake.manualSettings)
+				}
+				if len(*violations) != 1 || (*violations)[0].action != policyBlocked {
+					t.Errorf("violations = %+v", *violations)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("erreur inattendue: %v", err)
+			}
+			if len(fake.manualSettings) != 1 {
+				t.Fatalf("réglages transmis = %+v", fake.manualSettings)
+			}
+			got := fake.manualSettings[0]
+			if got.Mode != tt.wantMode || got.TemperatureTarget != tt.wantTemp {
+				t.Errorf("réglage transmis = %s %.1f, attendu %s %.1f", got.Mode, got.TemperatureTarget, tt.wantMode, tt.wantTemp)
+			}
+			adjusted := got.Mode != tt.request.Mode || got.TemperatureTarget != tt.request.TemperatureTarget
+			if adjusted != (len(*violations) == 1) {
+				t.Errorf("violations = %+v", *violations)
+			}
+		})
+	}
+}
+
+func TestPolicyDisableManualSettingNotChecked(t *testing.T) {
+	fake, client, violations := newTestPolicyClient(config.PolicyOptions{Name: "marche", ForbidOff: true})
+	if _, err := client.CreateManualSetting(api.UpdateManualSettingRequest{Enabled: false, IDAppliance: 1}); err != nil {
+		t.Fatalf("erreur inattendue: %v", err)
+	}
+	if len(fake.manualSettings) != 1 || len(*violations) != 0 {
+		t.Errorf("réglages = %+v, violations = %+v", fake.manualSettings, *violations)
+	}
+}
+
+func TestPolicyForbiddenProgramChangesNothing(t *testing.T) {
+	fake, client, violations := newTestPolicyClient(config.PolicyOptions{Name: "programmes", ForbiddenPrograms: "Vacances"})
+	programs := []api.Program{
+		{ID: 1, Name: "Semaine", Enabled: true},
+		{ID: 2, Name: "Vacances"},
+	}
+
+	if err := handleProgramChange(client, "Vacances", programs); !errors.Is(err, errPolicyBlocked) {
+		t.Fatalf("erreur = %v, attendu un blocage", err)
+	}
+	if len(fake.programs) != 0 {
+		t.Errorf("programmes modifiés malgré le blocage: %+v", fake.programs)
+	}
+	if len(*violations) != 1 {
+		t.Errorf("violations = %+v", *violations)
+	}
+
+	if err := handleProgramChange(client, "Aucun programme", programs); err != nil {
+		t.Fatalf("erreur inattendue: %v", err)
+	}
+	if len(fake.programs) != 1 || fake.programs[0].Name != "Semaine" || fake.programs[0].Enabled {
+		t.Errorf("programmes modifiés = %+v", fake.programs)
+	}
+}
+
+func TestPolicyEnableQuickSetting(t *testing.T) {
+	stored := []api.QuickSettings{{
+		ID:   3,
+		Name: "quicksettings.eco",
+		AppliancesSettings: []api.ApplianceSetting{
+			{IDAppliance: 1, Mode: "TEMPERATURE", TemperatureTarget: 14, IsOn: true},
+			{IDAppliance: 2, Mode: "TEMPERATURE", TemperatureTarget: 18, IsOn: true},
+		},
+	}}
+
+	t.Run("réglage ajusté réécrit avant activation", func(t *testing.T) {
+		fake, client, _ := newTestPolicyClient(config.PolicyOptions{Name: "bornes", MinTemperature: 16})
+		fake.quickSettings = stored
+		if err := client.EnableQuickSetting(3, true); err != nil {
+			t.Fatalf("erreur inattendue: %v", err)
+		}
+		if len(fake.updatedQS) != 1 || fake.updatedQS[0].AppliancesSettings[0].TemperatureTarget != 16 {
+			t.Errorf("quicksettings réécrits = %+v", fake.updatedQS)
+		}
+		if stored[0].AppliancesSettings[0].TemperatureTarget != 14 {
+			t.Errorf("le quicksetting lu a été modifié sur place")
+		}
+		if len(fake.enabledQS) != 1 {
+			t.Errorf("quicksetting non activé")
+		}
+	})
+
+	t.Run("réglage bloqué refuse l'activation", func(t *testing.T) {
+		fake, client, _ := newTestPolicyClient(config.PolicyOptions{Name: "bornes", MinTemperature: 16, Action: "block"})
+		fake.quickSettings = stored
+		if err := client.EnableQuickSetting(3, true); !errors.Is(err, errPolicyBlocked) {
+			t.Fatalf("erreur = %v, attendu un blocage", err)
+		}
+		if len(fake.updatedQS) != 0 || len(fake.enabledQS) != 0 {
+			t.Errorf("écritures malgré le blocage: %+v %+v", fake.updatedQS, fake.enabledQS)
+		}
+	})
+
+	t.Run("réglages conformes activés sans réécriture", func(t *testing.T) {
+		fake, client, _ := newTestPolicyClient(config.PolicyOptions{Name: "bornes", MinTemperature: 12})
+		fake.quickSettings = stored
+		if err := client.EnableQuickSetting(3, true); err != nil {
+			t.Fatalf("erreur inattendue: %v", err)
+		}
+		if len(fake.updatedQS) != 0 || len(fake.enabledQS) != 1 {
+			t.Errorf("réécritures = %+v, activations = %+v", fake.updatedQS, fake.enabledQS)
+		}
+	})
+}
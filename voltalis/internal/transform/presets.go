@@ -0,0 +1,46 @@
+package transform
+
+import (
+	"math"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/config"
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+)
+
+// presetTemperature associe un preset HA à la consigne configurée pour un radiateur (0 si non définie)
+type presetTemperature struct {
+	preset      state.HeaterPresetMode
+	temperature float64
+}
+
+// presetTemperatures retourne les consignes configurées pour chaque preset d'un radiateur,
+// dans l'ordre de priorité utilisé lorsque deux presets partagent la même consigne
+func presetTemperatures(heater config.HeaterOptions) []presetTemperature {
+	return []presetTemperature{
+		{state.HeaterPresetModeConfort, heater.ConfortTemperature},
+		{state.HeaterPresetModeEco, heater.EcoTemperature},
+		{state.HeaterPresetModeHorsGel, heater.HorsGelTemperature},
+	}
+}
+
+// withPresetTemperature remplace un mode Voltalis (CONFORT, ECO, HORS_GEL) par une consigne TEMPERATURE
+// lorsque le radiateur définit une température pour ce preset. Sinon le mode et la consigne sont inchangés
+// et le radiateur s'appuie sur ses consignes internes
+func withPresetTemperature(heater config.HeaterOptions, voltalisMode string, tempTarget float64) (string, float64) {
+	for _, preset := range presetTemperatures(heater) {
+		if preset.temperature > 0 && haPresetToVoltalisMode[preset.preset] == voltalisMode {
+			return "TEMPERATURE", preset.temperature
+		}
+	}
+	return voltalisMode, tempTarget
+}
+
+// presetFromTemperature retrouve le preset dont la température configurée correspond à une consigne TEMPERATURE lue chez Voltalis
+func presetFromTemperature(heater config.HeaterOptions, temperature float64) (state.HeaterPresetMode, bool) {
+	for _, preset := range presetTemperatures(heater) {
+		if preset.temperature > 0 && math.Abs(preset.temperature-temperature) < temperatureTolerance {
+			return preset.preset, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,178 @@
+package transform
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+)
+
+// Voltalis applique les commandes avec un léger délai : on relit le radiateur
+// jusqu'à ce que sa programmation change, dans la limite de refreshAttempts lectures
+const (
+	refreshDelay    = 2 * time.Second
+	refreshAttempts = 5
+)
+
+// programmings mémorise la dernière programmation publiée de chaque radiateur,
+// pour détecter la prise en compte d'une commande
+type programmings struct {
+	mu      sync.Mutex
+	heaters map[int64]api.Programming
+	// seen est la dernière fois où la programmation mémorisée a été constatée chez Voltalis
+	seen map[int64]time.Time
+}
+
+func (p *programmings) get(id int64) (api.Programming, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	programming, ok := p.heaters[id]
+	return programming, ok
+}
+
+func (p *programmings) set(id int64, programming api.Programming) {
+	p.mu.Lock()
+	p.heaters[id] = programming
+	p.seen[id] = time.Now()
+	p.mu.Unlock()
+}
+
+func (p *programmings) seenAt(id int64) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.seen[id]
+}
+
+// refreshAppliances relit uniquement les radiateurs indiqués et publie leur état dès que Voltalis
+// a pris en compte la commande, sans attendre la synchronisation complète du scheduler.
+// La relecture se fait en arrière-plan pour ne pas bloquer le traitement des commandes suivantes
+func (b *Bridge) refreshAppliances(ctx context.Context, ids []int64) {
+	if len(ids) == 0 {
+		return
+	}
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	if b.dryRun {
+		// Mode simulation : rien n'a été envoyé à Voltalis, les écritures simulées sont considérées comme confirmées.
+		// L'état affiché dans HA est conservé jusqu'à la prochaine synchronisation
+		for _, id := range ids {
+			b.pending.remove(id)
+			b.writes.confirm(int(id))
+		}
+		return
+	}
+	go func() {
+		// La relecture terminée, un changement ultérieur de la programmation ne vient plus de l'add-on
+		defer func() {
+			for _, id := range ids {
+				b.writes.confirm(int(id))
+			}
+		}()
+		pending := ids
+		var last map[int64]api.Appliance
+		for attempt := 1; attempt <= refreshAttempts && len(pending) > 0; attempt++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(refreshDelay):
+			}
+			last = make(map[int64]api.Appliance)
+			var converged []api.Appliance
+			var remaining []int64
+			for _, id := range pending {
+				appliance, err := b.apiClient.GetAppliance(int(id))
+				if err != nil {
+					slog.Error("failed to refresh appliance", "heaterID", id, "error", err)
+					remaining = append(remaining, id)
+					continue
+				}
+				if !b.converged(id, *appliance) {
+					last[id] = *appliance
+					remaining = append(remaining, id)
+					continue
+				}
+				b.pending.remove(id)
+				converged = append(converged, *appliance)
+			}
+			b.publishAppliances(converged)
+			pending = remaining
+		}
+		// Programmation inchangée (commande sans effet ou non encore appliquée) : on publie la dernière lecture,
+		// qui annule l'affichage optimiste de HA. La synchronisation périodique prendra le relais
+		var unchanged []api.Appliance
+		for _, id := range pending {
+			if _, waiting := b.pending.get(id); waiting {
+				b.failCommand(id, mqtt.EventCommandTimeout, fmt.Errorf("commande non confirmée par Voltalis après %d relectures", refreshAttempts))
+			}
+			if appliance, ok := last[id]; ok {
+				unchanged = append(unchanged, appliance)
+			}
+		}
+		if len(pending) > 0 {
+			slog.Debug("Radiateurs non convergés après relecture", "heaterIDs", pending)
+		}
+		b.publishAppliances(unchanged)
+	}()
+}
+
+// converged indique si la relecture d'un radiateur reflète la commande envoyée :
+// l'état demandé par HA s'il y en a un en attente, sinon un changement de programmation
+func (b *Bridge) converged(id int64, appliance api.Appliance) bool {
+	if cmd, ok := b.pending.get(id); ok {
+		return cmd.matches(b.mapAppliance(appliance, state.HeaterState{}))
+	}
+	known, ok := b.programmings.get(id)
+	return !ok || !reflect.DeepEqual(known, appliance.Programming)
+}
+
+// rollbackAppliances relit immédiatement les radiateurs dont la commande a échoué
+// et republie leur état réel à la place de l'état affiché de façon optimiste
+func (b *Bridge) rollbackAppliances(ctx context.Context, ids []int64) {
+	if len(ids) == 0 {
+		return
+	}
+	go func() {
+		var appliances []api.Appliance
+		for _, id := range ids {
+			if ctx.Err() != nil {
+				return
+			}
+			// La commande a échoué : aucun changement n'est plus attendu de l'add-on
+			b.writes.confirm(int(id))
+			appliance, err := b.apiClient.GetAppliance(int(id))
+			if err != nil {
+				slog.Error("failed to read appliance for rollback", "heaterID", id, "error", err)
+				continue
+			}
+			appliances = append(appliances, *appliance)
+		}
+		b.publishAppliances(appliances)
+	}()
+}
+
+// publishAppliances met à jour l'état des radiateurs relus et le publie sur leurs topics /get.
+// Seuls ces radiateurs sont modifiés dans le StateManager : la relecture tourne en arrière-plan
+// et ne doit pas écraser une commande HA reçue pendant ce temps
+func (b *Bridge) publishAppliances(appliances []api.Appliance) {
+	if len(appliances) == 0 {
+		return
+	}
+	byID := make(map[int64]api.Appliance, len(appliances))
+	ids := make([]int64, 0, len(appliances))
+	for _, appliance := range appliances {
+		byID[int64(appliance.ID)] = appliance
+		ids = append(ids, int64(appliance.ID))
+	}
+	updated := b.mqttClient.StateManager.UpdateHeatersWithoutNotification(ids, func(id int64, previous state.HeaterState) state.HeaterState {
+		return b.mapAppliance(byID[id], previous)
+	})
+	for _, appliance := range appliances {
+		b.publishHeater(appliance, updated[int64(appliance.ID)])
+	}
+}
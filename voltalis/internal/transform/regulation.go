@@ -0,0 +1,256 @@
+package transform
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/config"
+	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
+	"github.com/francois76/voltalis-integration/voltalis/internal/state"
+)
+
+const regulationInterval = 30 * time.Second
+
+// regulation est l'état de la boucle de régulation d'un radiateur.
+// Elle est engagée quand HA passe le radiateur en mode heat avec une consigne,
+// et désengagée dès qu'un autre mode ou preset est demandé
+type regulation struct {
+	options config.HeaterOptions
+
+	engaged   bool
+	setpoint  float64
+	commanded bool // un ordre a déjà été envoyé depuis l'engagement
+	fallback  bool // dernier ordre envoyé sans mesure de pièce (consigne directe)
+	heating   bool
+	switched  time.Time
+}
+
+// regulator pilote les radiateurs configurés avec une sonde de pièce et la régulation activée
+type regulator struct {
+	mu      sync.Mutex
+	heaters map[int64]*regulation
+}
+
+func newRegulator(heaters []config.HeaterOptions) *regulator {
+	r := &regulator{heaters: make(map[int64]*regulation)}
+	for _, heater := range heaters {
+		if heater.Regulation {
+			r.heaters[int64(heater.ApplianceID)] = &regulation{options: heater}
+		}
+	}
+	return r
+}
+
+// intercept engage ou désengage la régulation d'un radiateur suite à une commande HA.
+// Retourne true si la commande est prise en charge par la régulation
+func (r *regulator) intercept(id int64, heaterState state.HeaterState, changes state.Fields) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg, ok := r.heaters[id]
+	if !ok {
+		return false
+	}
+	if heaterState.Mode != state.HeaterModeHeat || changes.Has(state.FieldPresetMode) || heaterState.Temperature <= 0 {
+		if reg.engaged {
+			slog.Info("Régulation désengagée", "heaterID", id, "mode", heaterState.Mode)
+		}
+		reg.engaged = false
+		return false
+	}
+
+	if !reg.engaged {
+		slog.Info("Régulation engagée", "heaterID", id, "setpoint", heaterState.Temperature)
+		reg.engaged = true
+		reg.commanded = false
+	}
+	if reg.setpoint != heaterState.Temperature {
+		// Nouvelle consigne demandée par l'utilisateur : réévaluation immédiate
+		reg.setpoint = heaterState.Temperature
+		reg.commanded = false
+	}
+	return true
+}
+
+// release désengage la régulation d'un radiateur (retour à la programmation)
+func (r *regulator) release(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if reg, ok := r.heaters[id]; ok && reg.engaged {
+		slog.Info("Régulation désengagée", "heaterID", id)
+		reg.engaged = false
+	}
+}
+
+// engaged retourne les radiateurs dont la régulation est active
+func (r *regulator) engaged() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []int64
+	for id, reg := range r.heaters {
+		if reg.engaged {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// next calcule l'ordre à envoyer au radiateur selon la température de la pièce.
+// Retourne false si aucun ordre n'est nécessaire (état inchangé ou durée minimale non écoulée)
+func (r *regulator) next(id int64, room float64, hasRoom bool, now time.Time) (order state.HeaterState, changes state.Fields, heating bool, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reg, exists := r.heaters[id]
+	if !exists || !reg.engaged {
+		return state.HeaterState{}, nil, false, false
+	}
+
+	// Sans mesure exploitable, on se replie sur la consigne directe (thermostat interne du radiateur)
+	if !hasRoom {
+		if reg.commanded && reg.fallback {
+			return state.HeaterState{}, nil, false, false
+		}
+		slog.Warn("Régulation sans température de pièce, consigne directe", "heaterID", id, "setpoint", reg.setpoint)
+		order := state.HeaterState{Mode: state.HeaterModeHeat, Temperature: reg.setpoint}
+		return order, state.NewFields(state.FieldTemperature), reg.heating, true
+	}
+
+	hysteresis := orDefault(reg.options.RegulationHysteresis, 0.3)
+	heating = reg.heating
+	switch {
+	case room < reg.setpoint-hysteresis:
+		heating = true
+	case room > reg.setpoint+hysteresis:
+		heating = false
+	}
+
+	if reg.commanded && !reg.fallback {
+		if heating == reg.heating {
+			return state.HeaterState{}, nil, false, false
+		}
+		minDuration := time.Duration(orDefault(reg.options.RegulationMinOff, 10)) * time.Minute
+		if reg.heating {
+			minDuration = time.Duration(orDefault(reg.options.RegulationMinOn, 10)) * time.Minute
+		}
+		if now.Sub(reg.switched) < minDuration {
+			slog.Debug("Bascule de régulation différée", "heaterID", id, "room", room, "since", now.Sub(reg.switched))
+			return state.HeaterState{}, nil, false, false
+		}
+	}
+
+	slog.Info("Régulation", "heaterID", id, "room", room, "setpoint", reg.setpoint, "heating", heating)
+	if reg.options.RegulationStrategy == "temperature" {
+		offset := orDefault(reg.options.RegulationOffset, 2)
+		target := reg.setpoint - offset
+		if heating {
+			target = reg.setpoint + offset
+		}
+		order := state.HeaterState{Mode: state.HeaterModeHeat, Temperature: target}
+		return order, state.NewFields(state.FieldTemperature), heating, true
+	}
+
+	preset := state.HeaterPresetModeEco
+	if heating {
+		preset = state.HeaterPresetModeConfort
+	}
+	order = state.HeaterState{Mode: state.HeaterModeAuto, PresetMode: preset}
+	return order, state.NewFields(state.FieldPresetMode), heating, true
+}
+
+// commit enregistre l'ordre effectivement appliqué par Voltalis
+func (r *regulator) commit(id int64, heating bool, fallback bool, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg, ok := r.heaters[id]
+	if !ok {
+		return
+	}
+	if !reg.commanded || reg.heating != heating {
+		reg.switched = now
+	}
+	reg.commanded = true
+	reg.fallback = fallback
+	reg.heating = heating
+}
+
+// display remplace l'état lu chez Voltalis par la consigne suivie pour un radiateur régulé
+func (r *regulator) display(id int64, heaterState *state.HeaterState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg, ok := r.heaters[id]
+	if !ok || !reg.engaged || heaterState.Mode == state.HeaterModeOff {
+		return
+	}
+	heaterState.Mode = state.HeaterModeHeat
+	heaterState.PresetMode = ""
+	heaterState.Temperature = reg.setpoint
+}
+
+// action retourne l'indicateur de chauffe d'un radiateur régulé
+func (r *regulator) action(id int64) (mqtt.HeaterAction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reg, ok := r.heaters[id]
+	if !ok || !reg.engaged {
+		return "", false
+	}
+	if reg.heating {
+		return mqtt.HeaterActionHeating, true
+	}
+	return mqtt.HeaterActionIdle, true
+}
+
+// regulate évalue tous les radiateurs régulés
+// Retourne les radiateurs auxquels un ordre a été appliqué côté Voltalis
+func (b *Bridge) regulate(appliances []api.Appliance) []int64 {
+	ids := b.regulator.engaged()
+	if len(ids) == 0 {
+		return nil
+	}
+	manualSettings, err := b.apiClient.GetManualSettings()
+	if err != nil {
+		slog.Error("failed to load manual settings for regulation", "error", err)
+		return nil
+	}
+	var applied []int64
+	for _, id := range ids {
+		if b.regulateHeater(id, manualSettings, appliances) {
+			applied = append(applied, id)
+		}
+	}
+	return applied
+}
+
+// regulateHeater envoie si nécessaire un ordre au radiateur via le chemin des réglages manuels
+func (b *Bridge) regulateHeater(id int64, manualSettings []api.ManualSetting, appliances []api.Appliance) bool {
+	// Un forçage en cours (fenêtre ouverte...) suspend la régulation
+	if _, forced := b.overrides.get(id); forced {
+		return false
+	}
+	room, hasRoom := b.roomTemperatures.Get(id)
+	order, changes, heating, ok := b.regulator.next(id, room, hasRoom, time.Now())
+	if !ok {
+		return false
+	}
+	applied, err := handleSingleHeaterChange(b.apiClient, b.opts.Heater(int(id)), order, changes, manualSettings, appliances)
+	if err != nil {
+		slog.Error("failed to apply regulation order", "heaterID", id, "error", err)
+		return false
+	}
+	if applied {
+		b.regulator.commit(id, heating, !hasRoom, time.Now())
+	}
+	return applied
+}
+
+func orDefault[T int | float64 | time.Duration](value, fallback T) T {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
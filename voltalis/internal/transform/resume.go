@@ -0,0 +1,51 @@
+package transform
+
+import (
+	"log/slog"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+)
+
+// resumePrograms ramène les radiateurs à leur programmation en désactivant leur réglage manuel.
+// Les forçages en cours (boost, fenêtre) et la régulation sont abandonnés
+// Retourne les radiateurs pour lesquels des changements ont été appliqués côté Voltalis
+func (b *Bridge) resumePrograms(ids []int64) []int64 {
+	manualSettings, err := b.apiClient.GetManualSettings()
+	if err != nil {
+		slog.Error("failed to load manual settings to resume programs", "error", err)
+		return nil
+	}
+	var applied []int64
+	for _, id := range ids {
+		existingMS := findManualSetting(manualSettings, int(id))
+		if existingMS != nil && existingMS.Enabled {
+			if err := disableManualSetting(b.apiClient, existingMS); err != nil {
+				// Le réglage manuel reste en place : régulation, forçage et demande HA sont conservés
+				slog.Error("failed to resume program", "heaterID", id, "error", err)
+				continue
+			}
+			slog.Info("Retour à la programmation", "heaterID", id)
+			applied = append(applied, id)
+		} else {
+			slog.Debug("Pas de réglage manuel actif, radiateur déjà sur sa programmation", "heaterID", id)
+		}
+		b.regulator.release(id)
+		b.overrides.remove(id)
+		// La dernière demande HA est abandonnée : elle ne doit plus être réappliquée après un changement externe
+		b.mqttClient.StateManager.ClearIntent(id)
+	}
+	return applied
+}
+
+// disableManualSetting désactive un réglage manuel : le radiateur reprend son programme ou son quicksetting
+func disableManualSetting(apiClient voltalisClient, ms *api.ManualSetting) error {
+	request := api.UpdateManualSettingRequest{
+		Enabled:            false,
+		IDAppliance:        ms.IDAppliance,
+		UntilFurtherNotice: true,
+		IsOn:               false,
+		Mode:               ms.Mode,
+		TemperatureTarget:  ms.TemperatureTarget,
+	}
+	return apiClient.UpdateManualSetting(ms.ID, request)
+}
@@ -1,11 +1,10 @@
 package transform
 
 import (
-	"github.com/francois76/voltalis-integration/voltalis/internal/api"
 	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
 )
 
-func syncPrograms(controller *mqtt.Controller, apiClient *api.Client) error {
+func syncPrograms(controller *mqtt.Controller, apiClient voltalisClient) error {
 	programs, err := apiClient.GetPrograms()
 	if err != nil {
 		return err
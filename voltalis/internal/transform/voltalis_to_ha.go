@@ -2,13 +2,17 @@ package transform
 
 import (
 	"log/slog"
+	"math"
+	"time"
 
 	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/config"
 	"github.com/francois76/voltalis-integration/voltalis/internal/mqtt"
 	"github.com/francois76/voltalis-integration/voltalis/internal/state"
 )
 
-func SyncVoltalisHeatersToHA(mqttClient *mqtt.Client, apiClient *api.Client) error {
+func (b *Bridge) SyncVoltalisHeatersToHA() error {
+	mqttClient, apiClient := b.mqttClient, b.apiClient
 
 	// initialisation de l'état global
 	states := state.ResourceState{
@@ -22,86 +26,193 @@ func SyncVoltalisHeatersToHA(mqttClient *mqtt.Client, apiClient *api.Client) err
 	if err != nil {
 		return err
 	}
+	// Les durées choisies dans HA ne sont pas renvoyées par Voltalis : on conserve le choix courant
+	previous := mqttClient.StateManager.GetCurrentState()
+	if mqtt.IsDurationOption(previous.ControllerState.Duration) {
+		states.ControllerState.Duration = previous.ControllerState.Duration
+	}
+	var controllerEndDate *time.Time
+	var reapplies []reapplyRequest
 
 	for _, appliance := range appliances {
-		heaterState := &state.HeaterState{}
-		if !appliance.Programming.IsOn {
-			// Radiateur éteint
-			heaterState.Mode = state.HeaterModeOff
-			heaterState.PresetMode = state.HeaterPresetModeAucunMode
-		} else if appliance.Programming.ProgType == "MANUAL" {
-			// ManualSetting actif - le Mode indique ECO/CONFORT/HORS_GEL/TEMPERATURE
-			mapPreset(appliance, heaterState)
-			mapEndDate(appliance, heaterState)
-		} else if appliance.Programming.ProgType == "USER" {
-			// Programme utilisateur (hebdomadaire)
-			heaterState.Mode = state.HeaterModeAuto
-			mapPreset(appliance, heaterState)
-			mapEndDate(appliance, heaterState)
+		switch appliance.Programming.ProgType {
+		case "USER":
 			states.ControllerState.Program = appliance.Programming.ProgName
-		} else if appliance.Programming.ProgType == "QUICK" {
-			// QuickSetting (absence courte, etc.)
-			heaterState.Mode = state.HeaterModeAuto
-			mapPreset(appliance, heaterState)
-			mapEndDate(appliance, heaterState)
-			quickSettingsMappings := map[string]state.HeaterPresetMode{
-				"quicksettings.shortleave": state.HeaterPresetModeEco,
-				"quicksettings.athome":     state.HeaterPresetModeConfort,
-				"quicksettings.longleave":  state.HeaterPresetModeHorsGel,
-			}
-			states.ControllerState.Mode = quickSettingsMappings[appliance.Programming.ProgName]
-		} else if appliance.Programming.ProgType == "DEFAULT" {
-			// Mode par défaut (pas de programme actif, pas de manualSetting)
-			heaterState.Mode = state.HeaterModeAuto
-			mapPreset(appliance, heaterState)
-		} else {
-			slog.Error("unknown prog type", "progType", appliance.Programming.ProgType)
+		case "QUICK":
+			states.ControllerState.Mode = quickSettingsNameToMode[appliance.Programming.ProgName]
+			controllerEndDate = parseEndDate(apiClient, appliance.Programming.EndDate)
+		}
+		id := int64(appliance.ID)
+		if _, waiting := b.pending.get(id); waiting {
+			// Commande en attente de confirmation : on conserve l'état optimiste affiché dans HA
+			states.HeaterState[id] = previous.HeaterState[id]
+			continue
 		}
-		states.HeaterState[int64(appliance.ID)] = *heaterState
+		states.HeaterState[id] = b.mapAppliance(appliance, previous.HeaterState[id])
+		if request, reapply := b.detectExternalChange(appliance, previous.HeaterState[id], states.HeaterState[id]); reapply {
+			// La demande HA l'emporte : elle reste affichée en attente de sa réapplication
+			states.HeaterState[id] = request.state
+			b.pending.add(id, request.state, request.fields)
+			reapplies = append(reapplies, request)
+		}
+	}
+	// Le contrôleur affiche Boost tant que tous les radiateurs sont en boost
+	if len(appliances) > 0 && len(b.overrides.ids(overrideBoost)) == len(appliances) {
+		states.ControllerState.Mode = state.HeaterPresetModeBoost
 	}
 	slog.With("state", states).Debug("state after voltalis fetch")
 
 	// Mettre à jour le StateManager SANS déclencher de notification
 	// Cela évite la boucle : sync Voltalis -> StateManager -> API Voltalis
 	mqttClient.StateManager.UpdateStateWithoutNotification(states)
+	// Les réapplications partent de l'état mis à jour ci-dessus
+	for _, request := range reapplies {
+		b.reapplies.add(request)
+	}
 
 	// Publier sur les topics d'ÉTAT (/get) pour afficher dans Home Assistant
 	// NE PAS publier sur les topics de COMMANDE (/set) car cela déclencherait les listeners
 	controllerStates := mqttClient.BuildControllerStateTopic()
 
-	mqttClient.PublishState(controllerStates.Duration, states.ControllerState.Duration)
-	mqttClient.PublishState(controllerStates.Mode, string(states.ControllerState.Mode))
-	mqttClient.PublishState(controllerStates.Program, states.ControllerState.Program)
-	for id, heaterState := range states.HeaterState {
-		heaterStates := mqttClient.BuildHeaterStateTopic(id)
-		mqttClient.PublishState(heaterStates.SingleDuration, heaterState.Duration)
-		// Toujours publier le mode
-		if heaterState.Mode != "" {
-			mqttClient.PublishState(heaterStates.Mode, string(heaterState.Mode))
-		}
-		// Toujours publier le preset (même si mode est heat, pour garder l'état à jour)
-		if heaterState.PresetMode != "" {
-			mqttClient.PublishState(heaterStates.PresetMode, string(heaterState.PresetMode))
-		}
-		if heaterState.Temperature != 0 {
-			mqttClient.PublishState(heaterStates.Temperature, heaterState.Temperature)
+	controllerValues := map[mqtt.GetTopic]any{
+		controllerStates.Mode:      string(states.ControllerState.Mode),
+		controllerStates.Program:   states.ControllerState.Program,
+		controllerStates.EndDate:   endDateState(controllerEndDate),
+		controllerStates.Remaining: remainingState(controllerEndDate),
+		// Les entités de durée libre reflètent l'échéance effective du mode en cours
+		controllerStates.CustomDuration: remainingState(controllerEndDate),
+		controllerStates.CustomEndDate:  customEndDateState(controllerEndDate),
+	}
+	if states.ControllerState.Duration != "" {
+		controllerValues[controllerStates.Duration] = states.ControllerState.Duration
+	}
+	mqttClient.PublishStates(controllerValues)
+	for _, appliance := range appliances {
+		if _, waiting := b.pending.get(int64(appliance.ID)); waiting {
+			continue
 		}
-		// Publier l'action en fonction du preset (pour l'indicateur visuel)
-		action := presetToAction(heaterState.PresetMode, heaterState.Mode)
-		mqttClient.PublishState(heaterStates.Action, string(action))
+		b.publishHeater(appliance, states.HeaterState[int64(appliance.ID)])
 	}
 	return nil
 }
 
-func mapEndDate(appliance api.Appliance, heaterState *state.HeaterState) {
-	if appliance.Programming.EndDate != nil {
-		heaterState.Duration = *appliance.Programming.EndDate
+// mapAppliance convertit la programmation Voltalis d'un radiateur en état HA
+// previous est l'état connu du radiateur, dont on conserve ce que Voltalis ne renvoie pas (durée choisie, dernière consigne)
+func (b *Bridge) mapAppliance(appliance api.Appliance, previous state.HeaterState) state.HeaterState {
+	previousDuration := previous.Duration
+	heaterState := &state.HeaterState{LastTemperature: previous.LastTemperature}
+	heater := b.opts.Heater(appliance.ID)
+	if !appliance.Programming.IsOn {
+		// Radiateur éteint
+		heaterState.Mode = state.HeaterModeOff
+		heaterState.PresetMode = state.HeaterPresetModeAucunMode
+	} else if appliance.Programming.ProgType == "MANUAL" {
+		// ManualSetting actif - le Mode indique ECO/CONFORT/HORS_GEL/TEMPERATURE
+		mapPreset(appliance, heaterState, heater)
+		mapEndDate(appliance, heaterState, previousDuration)
+	} else if appliance.Programming.ProgType == "USER" {
+		// Programme utilisateur (hebdomadaire)
+		heaterState.Mode = state.HeaterModeAuto
+		mapPreset(appliance, heaterState, heater)
+		mapEndDate(appliance, heaterState, previousDuration)
+	} else if appliance.Programming.ProgType == "QUICK" {
+		// QuickSetting (absence courte, etc.)
+		heaterState.Mode = state.HeaterModeAuto
+		mapPreset(appliance, heaterState, heater)
+		mapEndDate(appliance, heaterState, previousDuration)
+	} else if appliance.Programming.ProgType == "DEFAULT" {
+		// Mode par défaut (pas de programme actif, pas de manualSetting)
+		heaterState.Mode = state.HeaterModeAuto
+		mapPreset(appliance, heaterState, heater)
 	} else {
-		heaterState.Duration = "Jusqu'à ce que je change d'avis"
+		slog.Error("unknown prog type", "progType", appliance.Programming.ProgType)
+	}
+	// Un radiateur régulé affiche la consigne suivie plutôt que le preset envoyé à Voltalis
+	b.regulator.display(int64(appliance.ID), heaterState)
+	b.displayBoost(int64(appliance.ID), heaterState)
+	return *heaterState
+}
+
+// publishHeater publie l'état d'un radiateur sur ses topics /get
+func (b *Bridge) publishHeater(appliance api.Appliance, heaterState state.HeaterState) {
+	id := int64(appliance.ID)
+	b.programmings.set(id, appliance.Programming)
+	end := parseEndDate(b.apiClient, appliance.Programming.EndDate)
+	heaterStates := b.mqttClient.BuildHeaterStateTopic(id)
+	// Toutes les valeurs d'un radiateur sont publiées d'un bloc (un seul document en mode JSON)
+	values := map[mqtt.GetTopic]any{
+		heaterStates.EndDate:   endDateState(end),
+		heaterStates.Remaining: remainingState(end),
+		// Les entités de durée libre reflètent l'échéance effective du mode en cours
+		heaterStates.CustomDuration: remainingState(end),
+		heaterStates.CustomEndDate:  customEndDateState(end),
 	}
+	// Le select ne reçoit que des options valides : la date de fin est exposée par les capteurs dédiés
+	if mqtt.IsDurationOption(heaterState.Duration) {
+		values[heaterStates.SingleDuration] = heaterState.Duration
+	}
+	// Toujours publier le mode
+	if heaterState.Mode != "" {
+		values[heaterStates.Mode] = string(heaterState.Mode)
+	}
+	// Toujours publier le preset (même si mode est heat, pour garder l'état à jour)
+	if heaterState.PresetMode != "" {
+		values[heaterStates.PresetMode] = string(heaterState.PresetMode)
+	}
+	if heaterState.Temperature != 0 {
+		values[heaterStates.Temperature] = heaterState.Temperature
+	}
+	// Publier l'action en fonction du preset (pour l'indicateur visuel)
+	action := presetToAction(heaterState.PresetMode, heaterState.Mode)
+	if regulatedAction, ok := b.regulator.action(id); ok {
+		action = regulatedAction
+	}
+	values[heaterStates.Action] = string(action)
+	values[heaterStates.BoostRemaining] = b.boostRemaining(id)
+	b.mqttClient.PublishStates(values)
+	if b.mqttClient.JSONState {
+		// Exposer le bloc de programmation brut comme attributs de l'entité climate
+		b.mqttClient.PublishState(heaterStates.Attributes, appliance.Programming)
+	}
+}
+
+// mapEndDate renseigne la durée affichée dans le select. Voltalis ne connaît que la date de fin :
+// pour un réglage limité dans le temps, on conserve l'option choisie dans HA si elle est encore valide
+func mapEndDate(appliance api.Appliance, heaterState *state.HeaterState, previousDuration string) {
+	if appliance.Programming.EndDate == nil {
+		heaterState.Duration = mqtt.DURATION_UNTIL_FURTHER_NOTICE
+	} else if previousDuration != mqtt.DURATION_UNTIL_FURTHER_NOTICE && mqtt.IsDurationOption(previousDuration) {
+		heaterState.Duration = previousDuration
+	}
+}
+
+// endDateState retourne l'état du capteur de fin (horodatage ISO 8601 avec fuseau)
+func endDateState(end *time.Time) string {
+	if end == nil {
+		return mqtt.STATE_NONE
+	}
+	return end.Format(time.RFC3339)
+}
+
+// remainingState retourne le nombre de minutes restantes avant la fin du mode en cours
+func remainingState(end *time.Time) any {
+	if end == nil {
+		return mqtt.STATE_NONE
+	}
+	return int(math.Ceil(math.Max(0, time.Until(*end).Minutes())))
 }
 
-func mapPreset(appliance api.Appliance, heaterState *state.HeaterState) {
+// customEndDateState retourne la valeur de l'entité texte "Fin du mode", au format accepté en commande (vide sans échéance)
+func customEndDateState(end *time.Time) string {
+	if end == nil {
+		return ""
+	}
+	return end.Format("2006-01-02 15:04")
+}
+
+// mapPreset convertit le mode Voltalis en mode et preset HA. Une consigne TEMPERATURE égale à la température
+// configurée pour un preset du radiateur est affichée comme ce preset
+func mapPreset(appliance api.Appliance, heaterState *state.HeaterState, heater config.HeaterOptions) {
 	switch appliance.Programming.Mode {
 	case "CONFORT":
 		heaterState.PresetMode = state.HeaterPresetModeConfort
@@ -113,9 +224,15 @@ func mapPreset(appliance api.Appliance, heaterState *state.HeaterState) {
 		heaterState.PresetMode = state.HeaterPresetModeHorsGel
 		heaterState.Mode = state.HeaterModeAuto
 	case "TEMPERATURE":
+		if preset, ok := presetFromTemperature(heater, appliance.Programming.TemperatureTarget); ok {
+			heaterState.PresetMode = preset
+			heaterState.Mode = state.HeaterModeAuto
+			return
+		}
 		// Mode température personnalisée = mode "heat" dans HA
 		heaterState.Mode = state.HeaterModeHeat
 		heaterState.Temperature = appliance.Programming.TemperatureTarget
+		heaterState.LastTemperature = appliance.Programming.TemperatureTarget
 	default:
 		heaterState.PresetMode = state.HeaterPresetModeAucunMode
 		heaterState.Mode = state.HeaterModeAuto
@@ -0,0 +1,54 @@
+package transform
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/francois76/voltalis-integration/voltalis/internal/api"
+	"github.com/francois76/voltalis-integration/voltalis/internal/sensors"
+)
+
+const defaultWindowMaxDuration = 4 * time.Hour
+
+// handleWindow force le Hors-Gel à l'ouverture prolongée d'une fenêtre et restaure l'état précédent à sa fermeture
+// Retourne true si des changements ont été appliqués côté Voltalis
+func (b *Bridge) handleWindow(event sensors.WindowEvent, appliances []api.Appliance) bool {
+	if !event.Open {
+		applied, err := b.restoreOverride(event.ApplianceID, overrideWindow)
+		if err != nil {
+			slog.Error("failed to restore heater after window closed", "heaterID", event.ApplianceID, "error", err)
+		}
+		return applied
+	}
+
+	if ov, ok := b.overrides.get(event.ApplianceID); ok && ov.Reason == overrideWindow {
+		return false
+	}
+
+	maxDuration := defaultWindowMaxDuration
+	if minutes := b.opts.Heater(int(event.ApplianceID)).WindowMaxDuration; minutes > 0 {
+		maxDuration = time.Duration(minutes) * time.Minute
+	}
+	// Réglage limité dans le temps : le radiateur revient de lui-même à sa programmation si la fermeture est perdue
+	until := time.Now().Add(maxDuration)
+	end := b.apiClient.FormatDate(until)
+	tempTarget := 0.0
+	for _, app := range appliances {
+		if int64(app.ID) == event.ApplianceID {
+			tempTarget = app.Programming.DefaultTemperature
+		}
+	}
+	request := api.UpdateManualSettingRequest{
+		Enabled:            true,
+		IDAppliance:        int(event.ApplianceID),
+		UntilFurtherNotice: false,
+		IsOn:               true,
+		EndDate:            &end,
+	}
+	request.Mode, request.TemperatureTarget = withPresetTemperature(b.opts.Heater(int(event.ApplianceID)), "HORS_GEL", tempTarget)
+	if err := b.applyOverride(event.ApplianceID, overrideWindow, until, request); err != nil {
+		slog.Error("failed to force frost protection on open window", "heaterID", event.ApplianceID, "error", err)
+		return false
+	}
+	return true
+}